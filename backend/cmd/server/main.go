@@ -7,7 +7,10 @@ import (
 	"github.com/PlonGuo/GoChatroom/backend/internal/database"
 	"github.com/PlonGuo/GoChatroom/backend/internal/router"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/media"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/schedule"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/storage"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/webrtc"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -42,11 +45,24 @@ func main() {
 	}
 	defer redis.Close()
 
+	// Initialize file storage
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+
+	// Start media processing workers
+	media.Start()
+	log.Println("Media workers started")
+
 	// Start WebSocket hub
 	hub := chat.GetHub()
 	go hub.Run()
 	log.Println("WebSocket hub started")
 
+	// Start scheduled message dispatcher
+	go schedule.Start()
+	log.Println("Message scheduler started")
+
 	// Start WebRTC signaling hub
 	signalingHub := webrtc.GetSignalingHub()
 	go signalingHub.Run()
@@ -19,6 +19,8 @@ type Config struct {
 	JWT      JWTConfig
 	CORS     CORSConfig
 	WebRTC   WebRTCConfig
+	Message  MessageConfig
+	Storage  StorageConfig
 }
 
 // AppConfig contains application server settings
@@ -63,6 +65,27 @@ type WebRTCConfig struct {
 	TURNPassword  string
 }
 
+// MessageConfig contains chat message policy settings
+type MessageConfig struct {
+	EditWindowMinutes   int // How long after sending a message can be edited, 0 for no limit
+	RecallWindowMinutes int // How long after sending a message can be recalled, 0 for no limit
+}
+
+// StorageConfig contains uploaded file storage settings
+type StorageConfig struct {
+	Driver      string // local or s3
+	LocalDir    string // Root directory for the local driver
+	MaxUploadMB int
+
+	// S3-compatible object storage
+	S3Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or a MinIO URL
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool // Address the bucket in the path rather than the host name
+}
+
 // Get returns the singleton config instance
 func Get() *Config {
 	once.Do(func() {
@@ -104,6 +127,21 @@ func load() *Config {
 			TURNUsername:  getEnv("TURN_USERNAME", ""),
 			TURNPassword:  getEnv("TURN_PASSWORD", ""),
 		},
+		Message: MessageConfig{
+			EditWindowMinutes:   getEnvInt("MESSAGE_EDIT_WINDOW_MINUTES", 15),
+			RecallWindowMinutes: getEnvInt("MESSAGE_RECALL_WINDOW_MINUTES", 2),
+		},
+		Storage: StorageConfig{
+			Driver:      getEnv("STORAGE_DRIVER", "local"),
+			LocalDir:    getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+			MaxUploadMB: getEnvInt("MAX_UPLOAD_MB", 20),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnvBool("S3_PATH_STYLE", true),
+		},
 	}
 }
 
@@ -125,6 +163,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvBool returns environment variable as bool or default
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
 // IsDevelopment returns true if running in development mode
 func (c *Config) IsDevelopment() bool {
 	return c.App.Env == "development"
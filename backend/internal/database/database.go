@@ -100,18 +100,40 @@ func Migrate() error {
 		return fmt.Errorf("database not initialized")
 	}
 
+	if err := dedupeSessions(); err != nil {
+		return fmt.Errorf("failed to remove duplicate sessions: %w", err)
+	}
+
 	err := DB.AutoMigrate(
 		&model.User{},
 		&model.Group{},
+		&model.GroupMember{},
 		&model.Contact{},
 		&model.ContactApply{},
 		&model.Session{},
 		&model.Message{},
+		&model.UserEvent{},
+		&model.UserEventSeq{},
+		&model.Reaction{},
+		&model.Upload{},
+		&model.Pin{},
+		&model.PinLock{},
+		&model.Thread{},
+		&model.ThreadFollower{},
+		&model.ScheduledMessage{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := migrateGroupMembers(); err != nil {
+		return fmt.Errorf("failed to migrate group members: %w", err)
+	}
+
+	if err := createSearchIndexes(); err != nil {
+		return fmt.Errorf("failed to create search indexes: %w", err)
+	}
+
 	log.Println("Database migrations completed")
 	return nil
 }
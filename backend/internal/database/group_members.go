@@ -0,0 +1,141 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// legacyGroup is a group row from before memberships moved out of the
+// groups.members JSON column into group_members
+type legacyGroup struct {
+	UUID      string
+	OwnerID   string
+	Members   string
+	CreatedAt time.Time
+}
+
+// migrateGroupMembers copies the member lists that used to live in
+// groups.members into group_members and drops the column. It does nothing
+// once the column is gone.
+func migrateGroupMembers() error {
+	if !DB.Migrator().HasColumn("groups", "members") {
+		return nil
+	}
+
+	var groups []legacyGroup
+	if err := DB.Table("groups").Select("uuid", "owner_id", "members", "created_at").
+		Find(&groups).Error; err != nil {
+		return fmt.Errorf("failed to load groups: %w", err)
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for i := range groups {
+			if err := migrateGroup(tx, &groups[i]); err != nil {
+				return fmt.Errorf("failed to migrate members of %s: %w", groups[i].UUID, err)
+			}
+		}
+		return tx.Migrator().DropColumn("groups", "members")
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Migrated members of %d groups to group_members", len(groups))
+	return nil
+}
+
+// migrateGroup adds a membership row for each listed member that has none yet
+// and recounts the group's members. Rows that already exist keep their role,
+// except that the owner's row is always the owner's.
+func migrateGroup(tx *gorm.DB, g *legacyGroup) error {
+	var existing []model.GroupMember
+	if err := tx.Select("id", "user_id", "role").Where("group_id = ?", g.UUID).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+
+	// A member joined when their group contact was created, where there is one
+	var contacts []model.Contact
+	if err := tx.Where("contact_id = ? AND contact_type = ?", g.UUID, model.ContactTypeGroup).
+		Find(&contacts).Error; err != nil {
+		return err
+	}
+	joinedAt := make(map[string]time.Time, len(contacts))
+	for _, c := range contacts {
+		joinedAt[c.UserID] = c.CreatedAt
+	}
+
+	rows, ownerRowID := planMembers(g, existing, joinedAt)
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+	}
+	if ownerRowID != 0 {
+		if err := tx.Model(&model.GroupMember{}).Where("id = ?", ownerRowID).
+			Update("role", model.GroupRoleOwner).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Table("groups").Where("uuid = ?", g.UUID).
+		Update("member_cnt", tx.Model(&model.GroupMember{}).Select("COUNT(*)").Where("group_id = ?", g.UUID)).Error
+}
+
+// planMembers works out the rows migrateGroup adds for the members in a
+// group's JSON list that have none yet, given the rows that exist and when
+// members joined. It also returns the ID of an existing owner row whose role
+// must be corrected, or 0.
+func planMembers(g *legacyGroup, existing []model.GroupMember, joinedAt map[string]time.Time) ([]model.GroupMember, int64) {
+	var ownerRowID int64
+	migrated := make(map[string]bool, len(existing))
+	for _, m := range existing {
+		migrated[m.UserID] = true
+		if m.UserID == g.OwnerID && m.Role != model.GroupRoleOwner {
+			ownerRowID = m.ID
+		}
+	}
+
+	var rows []model.GroupMember
+	for _, userID := range legacyMemberIDs(g) {
+		if migrated[userID] {
+			continue
+		}
+		row := model.GroupMember{GroupID: g.UUID, UserID: userID, Role: model.GroupRoleMember, JoinedAt: g.CreatedAt}
+		if userID == g.OwnerID {
+			row.Role = model.GroupRoleOwner
+		}
+		if t, ok := joinedAt[userID]; ok {
+			row.JoinedAt = t
+		}
+		rows = append(rows, row)
+	}
+	return rows, ownerRowID
+}
+
+// legacyMemberIDs parses a group's JSON member list, dropping repeats and
+// making sure the owner is included
+func legacyMemberIDs(g *legacyGroup) []string {
+	var members []string
+	if g.Members != "" {
+		if err := json.Unmarshal([]byte(g.Members), &members); err != nil {
+			log.Printf("Ignoring unreadable member list of %s: %v", g.UUID, err)
+		}
+	}
+
+	seen := make(map[string]bool, len(members)+1)
+	result := make([]string, 0, len(members)+1)
+	for _, userID := range append([]string{g.OwnerID}, members...) {
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		result = append(result, userID)
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLegacyMemberIDs(t *testing.T) {
+	g := &legacyGroup{UUID: "Ggroup", OwnerID: "Uowner", Members: `["Ualice","Uowner","Ualice","Ubob"]`}
+	assert.Equal(t, []string{"Uowner", "Ualice", "Ubob"}, legacyMemberIDs(g))
+
+	// The owner is kept even when the stored list is empty or unreadable
+	assert.Equal(t, []string{"Uowner"}, legacyMemberIDs(&legacyGroup{OwnerID: "Uowner"}))
+	assert.Equal(t, []string{"Uowner"}, legacyMemberIDs(&legacyGroup{OwnerID: "Uowner", Members: "not json"}))
+}
+
+func TestPlanMembers(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	aliceJoined := created.Add(time.Hour)
+	g := &legacyGroup{UUID: "Ggroup", OwnerID: "Uowner", Members: `["Uowner","Ualice","Ubob"]`, CreatedAt: created}
+
+	rows, ownerRowID := planMembers(g, nil, map[string]time.Time{"Ualice": aliceJoined})
+
+	assert.Zero(t, ownerRowID)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "Uowner", rows[0].UserID)
+	assert.Equal(t, int8(model.GroupRoleOwner), rows[0].Role)
+	assert.Equal(t, int8(model.GroupRoleMember), rows[1].Role)
+	assert.Equal(t, aliceJoined, rows[1].JoinedAt)
+	// Without a contact the member is dated from the group
+	assert.Equal(t, created, rows[2].JoinedAt)
+	assert.Equal(t, "Ggroup", rows[2].GroupID)
+}
+
+func TestPlanMembers_SecondRunAddsNothing(t *testing.T) {
+	g := &legacyGroup{UUID: "Ggroup", OwnerID: "Uowner", Members: `["Uowner","Ualice"]`}
+
+	first, _ := planMembers(g, nil, nil)
+	for i := range first {
+		first[i].ID = int64(i + 1)
+	}
+
+	rows, ownerRowID := planMembers(g, first, nil)
+	assert.Empty(t, rows)
+	assert.Zero(t, ownerRowID)
+}
+
+func TestPlanMembers_KeepsExistingRoles(t *testing.T) {
+	g := &legacyGroup{UUID: "Ggroup", OwnerID: "Uowner", Members: `["Uowner","Ualice","Ubob"]`}
+	existing := []model.GroupMember{
+		{ID: 1, UserID: "Uowner", Role: model.GroupRoleMember},
+		{ID: 2, UserID: "Ualice", Role: model.GroupRoleAdmin},
+	}
+
+	rows, ownerRowID := planMembers(g, existing, nil)
+
+	// Alice stays an admin; only Bob is added, and the owner's row is corrected
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "Ubob", rows[0].UserID)
+	assert.Equal(t, int8(model.GroupRoleMember), rows[0].Role)
+	assert.Equal(t, int64(1), ownerRowID)
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// MessageSearchVector is the PostgreSQL text-search expression over message
+// content and file names. Queries must use it verbatim to hit the GIN index.
+const MessageSearchVector = "to_tsvector('simple', coalesce(content, '') || ' ' || coalesce(file_name, ''))"
+
+// MessageSearchColumns are the columns covered by the MySQL FULLTEXT index
+const MessageSearchColumns = "content, file_name"
+
+const messageSearchIndex = "idx_messages_search"
+
+// createSearchIndexes adds the full-text index on messages for the connected
+// database; AutoMigrate can't express either dialect's index
+func createSearchIndexes() error {
+	switch DB.Dialector.Name() {
+	case "postgres":
+		return DB.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON messages USING GIN (%s)",
+			messageSearchIndex, MessageSearchVector)).Error
+	case "mysql":
+		// MySQL has no IF NOT EXISTS for indexes
+		if DB.Migrator().HasIndex("messages", messageSearchIndex) {
+			return nil
+		}
+		return DB.Exec(fmt.Sprintf("ALTER TABLE messages ADD FULLTEXT INDEX %s (%s)",
+			messageSearchIndex, MessageSearchColumns)).Error
+	default:
+		log.Printf("No full-text index for %s; message search will be slow", DB.Dialector.Name())
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+)
+
+const sessionOwnerIndex = "idx_sessions_owner_receiver"
+
+// dedupeSessions removes extra sessions for the same owner and conversation,
+// left by concurrent first messages before the unique index existed, so
+// AutoMigrate can add it. A live session is kept over a deleted one, then the
+// oldest. It does nothing once the index exists.
+func dedupeSessions() error {
+	if !DB.Migrator().HasTable(&model.Session{}) || DB.Migrator().HasIndex(&model.Session{}, sessionOwnerIndex) {
+		return nil
+	}
+
+	// MySQL can't select from the table it deletes from, except through a
+	// derived table
+	if err := DB.Exec(`DELETE FROM sessions WHERE id IN (SELECT id FROM (
+		SELECT d.id FROM sessions d JOIN sessions l
+		ON l.send_id = d.send_id AND l.receive_id = d.receive_id AND l.deleted_at IS NULL
+		WHERE d.deleted_at IS NOT NULL) AS deleted_duplicates)`).Error; err != nil {
+		return fmt.Errorf("failed to remove deleted duplicate sessions: %w", err)
+	}
+	if err := DB.Exec(`DELETE FROM sessions WHERE id NOT IN (SELECT id FROM (
+		SELECT MIN(id) AS id FROM sessions GROUP BY send_id, receive_id) AS kept)`).Error; err != nil {
+		return fmt.Errorf("failed to remove duplicate sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
+	"github.com/PlonGuo/GoChatroom/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+// Room allowed on top of the file itself for the multipart envelope
+const multipartOverhead = 1 << 20
+
+// UploadFile stores a file sent as the "file" field of a multipart form
+func UploadFile(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, upload.MaxSize()+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.BadRequest(c, "File is too large")
+			return
+		}
+		response.BadRequest(c, "File is required")
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		response.InternalError(c, "Failed to read file")
+		return
+	}
+	defer f.Close()
+
+	file, err := upload.Save(userID.(string), header.Filename, header.Size, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, upload.ErrEmptyFile):
+			response.BadRequest(c, "File is empty")
+		case errors.Is(err, upload.ErrFileTooLarge):
+			response.BadRequest(c, "File is too large")
+		case errors.Is(err, upload.ErrFileTypeNotAllowed):
+			response.BadRequest(c, "File type not allowed")
+		default:
+			response.InternalError(c, "Failed to upload file")
+		}
+		return
+	}
+
+	response.Created(c, file)
+}
+
+// DownloadFile streams an uploaded file to its owner or a member of a conversation it was sent to
+func DownloadFile(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	record, content, err := upload.Open(c.Param("uuid"), userID.(string))
+	if err != nil {
+		respondFileError(c, err, "Failed to download file")
+		return
+	}
+	defer content.Close()
+
+	// Media can be shown in place; anything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(record.MimeType, "image/") || strings.HasPrefix(record.MimeType, "audio/") ||
+		strings.HasPrefix(record.MimeType, "video/") {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, record.Size, record.MimeType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": record.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=86400",
+	})
+}
+
+// DownloadThumbnail streams an image file's thumbnail, generating it if needed
+func DownloadThumbnail(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	content, contentType, err := upload.OpenThumbnail(c.Param("uuid"), userID.(string))
+	if err != nil {
+		respondFileError(c, err, "Failed to get thumbnail")
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, -1, contentType, content, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=86400",
+	})
+}
+
+// RegenerateThumbnail rebuilds the thumbnail and metadata of the current user's image
+func RegenerateThumbnail(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	file, err := upload.RegenerateMedia(c.Param("uuid"), userID.(string))
+	if err != nil {
+		if errors.Is(err, upload.ErrFileTypeNotAllowed) {
+			response.BadRequest(c, "File is not an image")
+			return
+		}
+		respondFileError(c, err, "Failed to regenerate thumbnail")
+		return
+	}
+
+	response.Success(c, file)
+}
+
+// respondFileError maps errors shared by file endpoints to HTTP responses
+func respondFileError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, upload.ErrFileNotFound):
+		response.NotFound(c, "File not found")
+	case errors.Is(err, upload.ErrFileAccessDenied):
+		response.Forbidden(c, "You cannot access this file")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/group"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
 	"github.com/PlonGuo/GoChatroom/backend/pkg/response"
 	"github.com/gin-gonic/gin"
 )
@@ -45,7 +46,7 @@ func GetGroup(c *gin.Context) {
 		return
 	}
 
-	response.Success(c, gin.H{
+	resp := gin.H{
 		"uuid":      grp.UUID,
 		"name":      grp.Name,
 		"notice":    grp.Notice,
@@ -53,10 +54,18 @@ func GetGroup(c *gin.Context) {
 		"ownerId":   grp.OwnerID,
 		"addMode":   grp.AddMode,
 		"memberCnt": grp.MemberCnt,
-	})
+
+		"messageTtl": grp.MessageTTL,
+	}
+	// Only members see what is pinned
+	userID, _ := c.Get("userID")
+	if pins := group.GetPins(grp, userID.(string)); pins != nil {
+		resp["pins"] = pins
+	}
+	response.Success(c, resp)
 }
 
-// UpdateGroup updates group info (owner only)
+// UpdateGroup updates group info (owner or admin)
 func UpdateGroup(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	uuid := c.Param("uuid")
@@ -73,8 +82,8 @@ func UpdateGroup(c *gin.Context) {
 			response.NotFound(c, "Group not found")
 			return
 		}
-		if errors.Is(err, group.ErrNotGroupOwner) {
-			response.Forbidden(c, "Only group owner can update group info")
+		if errors.Is(err, group.ErrNotGroupAdmin) {
+			response.Forbidden(c, "Only group owner or admins can update group info")
 			return
 		}
 		response.InternalError(c, "Failed to update group")
@@ -84,6 +93,35 @@ func UpdateGroup(c *gin.Context) {
 	response.Success(c, result)
 }
 
+// SetGroupMessageTTL sets how long new messages in a group are kept (owner or admin)
+func SetGroupMessageTTL(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	var req MessageTTLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := group.SetMessageTTL(uuid, userID.(string), *req.TTLSeconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrGroupNotFound):
+			response.NotFound(c, "Group not found")
+		case errors.Is(err, group.ErrNotGroupAdmin):
+			response.Forbidden(c, "Only group owner or admins can change message retention")
+		case errors.Is(err, session.ErrInvalidMessageTTL):
+			response.BadRequest(c, "Message retention must be 0 or between one minute and one year")
+		default:
+			response.InternalError(c, "Failed to set message retention")
+		}
+		return
+	}
+
+	response.Success(c, result)
+}
+
 // DissolveGroup dissolves a group (owner only)
 func DissolveGroup(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -167,7 +205,7 @@ func LeaveGroup(c *gin.Context) {
 	response.Success(c, gin.H{"message": "Left group successfully"})
 }
 
-// KickMember removes a user from a group (owner only)
+// KickMember removes a user from a group (owner or admin)
 func KickMember(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	groupUUID := c.Param("uuid")
@@ -179,8 +217,12 @@ func KickMember(c *gin.Context) {
 			response.NotFound(c, "Group not found")
 			return
 		}
-		if errors.Is(err, group.ErrNotGroupOwner) {
-			response.Forbidden(c, "Only group owner can kick members")
+		if errors.Is(err, group.ErrNotGroupAdmin) {
+			response.Forbidden(c, "Only group owner or admins can kick members")
+			return
+		}
+		if errors.Is(err, group.ErrOutranked) {
+			response.Forbidden(c, "Admins cannot kick the owner or other admins")
 			return
 		}
 		if errors.Is(err, group.ErrNotInGroup) {
@@ -194,6 +236,70 @@ func KickMember(c *gin.Context) {
 	response.Success(c, gin.H{"message": "Member removed"})
 }
 
+// PromoteAdmin makes a member a group admin (owner only)
+func PromoteAdmin(c *gin.Context) {
+	setAdmin(c, true)
+}
+
+// DemoteAdmin makes a group admin a plain member again (owner only)
+func DemoteAdmin(c *gin.Context) {
+	setAdmin(c, false)
+}
+
+func setAdmin(c *gin.Context, admin bool) {
+	userID, _ := c.Get("userID")
+	groupUUID := c.Param("uuid")
+	memberUUID := c.Param("memberUuid")
+
+	if err := group.SetAdmin(groupUUID, memberUUID, userID.(string), admin); err != nil {
+		switch {
+		case errors.Is(err, group.ErrGroupNotFound), errors.Is(err, group.ErrGroupDissolved):
+			response.NotFound(c, "Group not found")
+		case errors.Is(err, group.ErrNotGroupOwner):
+			response.Forbidden(c, "Only group owner can change admins")
+		case errors.Is(err, group.ErrOutranked):
+			response.BadRequest(c, "The owner's role cannot be changed")
+		case errors.Is(err, group.ErrNotInGroup):
+			response.BadRequest(c, "User is not a member of this group")
+		default:
+			response.InternalError(c, "Failed to change member role")
+		}
+		return
+	}
+
+	message := "Admin removed"
+	if admin {
+		message = "Admin added"
+	}
+	response.Success(c, gin.H{"message": message})
+}
+
+// SetGroupNickname sets the name the current user goes by in a group
+func SetGroupNickname(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	var req group.NicknameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := group.SetNickname(uuid, userID.(string), req.Nickname); err != nil {
+		switch {
+		case errors.Is(err, group.ErrGroupNotFound), errors.Is(err, group.ErrGroupDissolved):
+			response.NotFound(c, "Group not found")
+		case errors.Is(err, group.ErrNotInGroup):
+			response.BadRequest(c, "Not a member of this group")
+		default:
+			response.InternalError(c, "Failed to set group nickname")
+		}
+		return
+	}
+
+	response.Success(c, gin.H{"nickname": req.Nickname})
+}
+
 // SearchGroups searches for groups by name
 func SearchGroups(c *gin.Context) {
 	query := c.Query("q")
@@ -1,9 +1,18 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/message"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/pin"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/user"
 	"github.com/PlonGuo/GoChatroom/backend/pkg/response"
 	"github.com/gin-gonic/gin"
@@ -28,6 +37,31 @@ func SendMessage(c *gin.Context) {
 
 	msg, err := message.Create(userID.(string), nickname.(string), avatar, req)
 	if err != nil {
+		if permErr, ok := permission.AsError(err); ok {
+			response.Forbidden(c, permErr.Message)
+			return
+		}
+		if errors.Is(err, reply.ErrReplyNotFound) || errors.Is(err, reply.ErrReplyOtherChat) {
+			response.BadRequest(c, "Invalid reply: "+err.Error())
+			return
+		}
+		if errors.Is(err, upload.ErrInvalidAttachment) {
+			response.BadRequest(c, "Invalid attachment: "+err.Error())
+			return
+		}
+		if errors.Is(err, mention.ErrMentionAllForbidden) {
+			response.Forbidden(c, err.Error())
+			return
+		}
+		if errors.Is(err, mention.ErrInvalidMention) || errors.Is(err, mention.ErrTooManyMentions) {
+			response.BadRequest(c, "Invalid mention: "+err.Error())
+			return
+		}
+		var sendErr *chat.SendError
+		if errors.As(err, &sendErr) && sendErr.Code != "internal_error" {
+			response.BadRequest(c, sendErr.Reason)
+			return
+		}
 		response.InternalError(c, "Failed to send message")
 		return
 	}
@@ -35,42 +69,270 @@ func SendMessage(c *gin.Context) {
 	response.Created(c, msg)
 }
 
-// GetMessages returns messages for a session
+// ForwardMessages copies messages into other conversations
+func ForwardMessages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	nickname, _ := c.Get("nickname")
+
+	var req message.ForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	avatar := ""
+	if u, err := user.GetByUUID(userID.(string)); err == nil {
+		avatar = u.Avatar
+	}
+
+	msgs, err := message.Forward(userID.(string), nickname.(string), avatar, req)
+	if err != nil {
+		if permErr, ok := permission.AsError(err); ok {
+			response.Forbidden(c, permErr.Message)
+			return
+		}
+		var sendErr *chat.SendError
+		switch {
+		case errors.As(err, &sendErr):
+			response.BadRequest(c, sendErr.Reason)
+		case errors.Is(err, message.ErrMessageNotFound):
+			response.NotFound(c, "Message not found")
+		case errors.Is(err, message.ErrNothingToForward):
+			response.BadRequest(c, "Nothing to forward")
+		case errors.Is(err, message.ErrTooManyForwards):
+			response.BadRequest(c, "Too many messages or targets")
+		case errors.Is(err, message.ErrNotForwardable):
+			response.BadRequest(c, "Recalled messages and calls cannot be forwarded")
+		default:
+			response.InternalError(c, "Failed to forward messages")
+		}
+		return
+	}
+
+	response.Created(c, msgs)
+}
+
+// GetMessages returns messages for one of the current user's sessions
 func GetMessages(c *gin.Context) {
+	userID, _ := c.Get("userID")
 	sessionID := c.Query("sessionId")
 	if sessionID == "" {
 		response.BadRequest(c, "Session ID is required")
 		return
 	}
 
-	limit := 50
-	offset := 0
+	query := message.HistoryQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Around: c.Query("around"),
+	}
 	if l := c.Query("limit"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
+			query.Limit = parsed
 		}
 	}
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
+
+	page, err := message.GetBySessionID(sessionID, userID.(string), query)
+	if err != nil {
+		if permErr, ok := permission.AsError(err); ok {
+			response.Forbidden(c, permErr.Message)
+			return
+		}
+		switch {
+		case errors.Is(err, session.ErrSessionNotFound):
+			response.NotFound(c, "Session not found")
+		case errors.Is(err, message.ErrInvalidCursor):
+			response.BadRequest(c, "Invalid history cursor")
+		case errors.Is(err, message.ErrMessageNotFound):
+			response.NotFound(c, "Message not found")
+		default:
+			response.InternalError(c, "Failed to get messages")
 		}
+		return
+	}
+
+	response.Success(c, page)
+}
+
+// EditMessage changes the content of one of the current user's messages
+func EditMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	var req message.EditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
 	}
 
-	messages, err := message.GetBySessionID(sessionID, limit, offset)
+	msg, err := message.Edit(uuid, userID.(string), req)
+	if err != nil {
+		respondMessageChangeError(c, err, "Failed to edit message")
+		return
+	}
+
+	response.Success(c, msg)
+}
+
+// RecallMessage withdraws one of the current user's messages
+func RecallMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	msg, err := message.Recall(uuid, userID.(string))
 	if err != nil {
-		response.InternalError(c, "Failed to get messages")
+		respondMessageChangeError(c, err, "Failed to recall message")
 		return
 	}
 
-	response.Success(c, messages)
+	response.Success(c, msg)
+}
+
+// AddReaction adds an emoji reaction from the current user to a message
+func AddReaction(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	var req message.ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := message.AddReaction(uuid, userID.(string), req.Emoji); err != nil {
+		if errors.Is(err, message.ErrReactionExists) {
+			response.BadRequest(c, "Reaction already added")
+			return
+		}
+		respondReactionError(c, err, "Failed to add reaction")
+		return
+	}
+
+	response.Created(c, gin.H{"message": "Reaction added"})
+}
+
+// RemoveReaction removes the current user's emoji reaction from a message
+func RemoveReaction(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	if err := message.RemoveReaction(uuid, userID.(string), c.Query("emoji")); err != nil {
+		if errors.Is(err, message.ErrReactionNotFound) {
+			response.NotFound(c, "Reaction not found")
+			return
+		}
+		respondReactionError(c, err, "Failed to remove reaction")
+		return
+	}
+
+	response.Success(c, gin.H{"message": "Reaction removed"})
+}
+
+// respondReactionError maps errors shared by reaction endpoints to HTTP responses
+func respondReactionError(c *gin.Context, err error, fallback string) {
+	if permErr, ok := permission.AsError(err); ok {
+		response.Forbidden(c, permErr.Message)
+		return
+	}
+	switch {
+	case errors.Is(err, message.ErrInvalidEmoji):
+		response.BadRequest(c, "Invalid emoji")
+	case errors.Is(err, message.ErrMessageNotFound):
+		response.NotFound(c, "Message not found")
+	case errors.Is(err, message.ErrMessageRecalled):
+		response.BadRequest(c, "Message has been recalled")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
+
+// respondMessageChangeError maps edit/recall errors to HTTP responses
+func respondMessageChangeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, message.ErrMessageNotFound):
+		response.NotFound(c, "Message not found")
+	case errors.Is(err, message.ErrNotMessageSender):
+		response.Forbidden(c, "You can only change your own messages")
+	case errors.Is(err, message.ErrMessageRecalled):
+		response.BadRequest(c, "Message has been recalled")
+	case errors.Is(err, message.ErrMessageNotEditable):
+		response.BadRequest(c, "Only text messages can be edited")
+	case errors.Is(err, message.ErrEditWindowExpired):
+		response.Forbidden(c, "Message can no longer be edited")
+	case errors.Is(err, message.ErrRecallWindowExpired):
+		response.Forbidden(c, "Message can no longer be recalled")
+	case errors.Is(err, message.ErrEmptyMessageContent):
+		response.BadRequest(c, "Message content cannot be empty")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
+
+// SearchMessages searches the current user's conversations
+func SearchMessages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	query := message.SearchQuery{
+		Query:     c.Query("q"),
+		SenderID:  c.Query("sender"),
+		ReceiveID: c.Query("conversation"),
+		Cursor:    c.Query("cursor"),
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.Limit = parsed
+		}
+	}
+	if t := c.Query("type"); t != "" {
+		parsed, err := strconv.ParseInt(t, 10, 8)
+		if err != nil {
+			response.BadRequest(c, "Invalid message type")
+			return
+		}
+		msgType := int8(parsed)
+		query.Type = &msgType
+	}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			response.BadRequest(c, "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+		query.From = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			response.BadRequest(c, "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		// The end date is inclusive
+		query.To = parsed.AddDate(0, 0, 1)
+	}
+
+	result, err := message.Search(userID.(string), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, message.ErrEmptySearchQuery):
+			response.BadRequest(c, "Search query is required")
+		case errors.Is(err, message.ErrInvalidCursor):
+			response.BadRequest(c, "Invalid search cursor")
+		default:
+			response.InternalError(c, "Failed to search messages")
+		}
+		return
+	}
+
+	response.Success(c, result)
 }
 
 // MarkAsRead marks a message as read
 func MarkAsRead(c *gin.Context) {
+	userID, _ := c.Get("userID")
 	uuid := c.Param("uuid")
 
-	if err := message.MarkAsRead(uuid); err != nil {
-		response.InternalError(c, "Failed to mark as read")
+	if err := message.MarkAsRead(uuid, userID.(string)); err != nil {
+		respondReadError(c, err, "Failed to mark as read")
 		return
 	}
 
@@ -83,13 +345,47 @@ func MarkAllAsRead(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 
 	if err := message.MarkAllAsRead(sessionID, userID.(string)); err != nil {
-		response.InternalError(c, "Failed to mark messages as read")
+		respondReadError(c, err, "Failed to mark messages as read")
 		return
 	}
 
 	response.Success(c, gin.H{"message": "All messages marked as read"})
 }
 
+// GetReadReceipts returns who has read one of the current user's messages
+func GetReadReceipts(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	receipts, err := message.GetReadReceipts(uuid, userID.(string))
+	if err != nil {
+		respondReadError(c, err, "Failed to get read receipts")
+		return
+	}
+
+	response.Success(c, receipts)
+}
+
+// respondReadError maps read receipt errors to HTTP responses
+func respondReadError(c *gin.Context, err error, fallback string) {
+	if permErr, ok := permission.AsError(err); ok {
+		response.Forbidden(c, permErr.Message)
+		return
+	}
+	switch {
+	case errors.Is(err, message.ErrMessageNotFound):
+		response.NotFound(c, "Message not found")
+	case errors.Is(err, session.ErrSessionNotFound):
+		response.NotFound(c, "Session not found")
+	case errors.Is(err, message.ErrNotMessageRecipient):
+		response.Forbidden(c, "You can only mark messages sent to you as read")
+	case errors.Is(err, message.ErrNotMessageSender):
+		response.Forbidden(c, "You can only view receipts for your own messages")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
+
 // GetUnreadCount returns the total unread message count
 func GetUnreadCount(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -102,3 +398,180 @@ func GetUnreadCount(c *gin.Context) {
 
 	response.Success(c, gin.H{"count": count})
 }
+
+// PinMessage pins a message to the top of its conversation
+func PinMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	p, err := pin.Pin(c.Param("uuid"), userID.(string))
+	if err != nil {
+		respondPinError(c, err, "Failed to pin message")
+		return
+	}
+
+	response.Created(c, p)
+}
+
+// UnpinMessage removes a message from its conversation's pins
+func UnpinMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := pin.Unpin(c.Param("uuid"), userID.(string)); err != nil {
+		respondPinError(c, err, "Failed to unpin message")
+		return
+	}
+
+	response.Success(c, gin.H{"message": "Message unpinned"})
+}
+
+// GetPins lists the pinned messages of a conversation
+func GetPins(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	conversation := c.Query("conversation")
+	if conversation == "" {
+		response.BadRequest(c, "Conversation is required")
+		return
+	}
+
+	pins, err := pin.List(userID.(string), conversation)
+	if err != nil {
+		respondPinError(c, err, "Failed to get pinned messages")
+		return
+	}
+
+	response.Success(c, pins)
+}
+
+// respondPinError maps pin errors to HTTP responses
+func respondPinError(c *gin.Context, err error, fallback string) {
+	if permErr, ok := permission.AsError(err); ok {
+		response.Forbidden(c, permErr.Message)
+		return
+	}
+	switch {
+	case errors.Is(err, pin.ErrMessageNotFound):
+		response.NotFound(c, "Message not found")
+	case errors.Is(err, pin.ErrPinNotFound):
+		response.NotFound(c, "Message is not pinned")
+	case errors.Is(err, pin.ErrNotAllowed):
+		response.Forbidden(c, "Only the group owner or admins can pin messages")
+	case errors.Is(err, pin.ErrMessageRecalled):
+		response.BadRequest(c, "Message has been recalled")
+	case errors.Is(err, pin.ErrAlreadyPinned):
+		response.BadRequest(c, "Message is already pinned")
+	case errors.Is(err, pin.ErrPinLimitReached):
+		response.BadRequest(c, "Too many pinned messages in this conversation")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
+
+// GetThread returns a thread root and a page of its replies
+func GetThread(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	query := message.HistoryQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Around: c.Query("around"),
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.Limit = parsed
+		}
+	}
+
+	page, err := message.GetThread(c.Param("uuid"), userID.(string), query)
+	if err != nil {
+		respondThreadError(c, err, "Failed to get thread")
+		return
+	}
+
+	response.Success(c, page)
+}
+
+// ReplyInThread posts a reply inside a message's thread
+func ReplyInThread(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	nickname, _ := c.Get("nickname")
+
+	var req message.ThreadReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	avatar := ""
+	if u, err := user.GetByUUID(userID.(string)); err == nil {
+		avatar = u.Avatar
+	}
+
+	msg, err := message.ReplyInThread(userID.(string), nickname.(string), avatar, c.Param("uuid"), req)
+	if err != nil {
+		if errors.Is(err, upload.ErrInvalidAttachment) {
+			response.BadRequest(c, "Invalid attachment: "+err.Error())
+			return
+		}
+		if errors.Is(err, mention.ErrMentionAllForbidden) {
+			response.Forbidden(c, err.Error())
+			return
+		}
+		var sendErr *chat.SendError
+		if errors.As(err, &sendErr) && sendErr.Code != "internal_error" {
+			response.BadRequest(c, sendErr.Reason)
+			return
+		}
+		respondThreadError(c, err, "Failed to reply in thread")
+		return
+	}
+
+	response.Created(c, msg)
+}
+
+// FollowThread subscribes the current user to a thread's replies
+func FollowThread(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := message.FollowThread(c.Param("uuid"), userID.(string)); err != nil {
+		respondThreadError(c, err, "Failed to follow thread")
+		return
+	}
+
+	response.Success(c, gin.H{"message": "Thread followed"})
+}
+
+// UnfollowThread unsubscribes the current user from a thread's replies
+func UnfollowThread(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := message.UnfollowThread(c.Param("uuid"), userID.(string)); err != nil {
+		respondThreadError(c, err, "Failed to unfollow thread")
+		return
+	}
+
+	response.Success(c, gin.H{"message": "Thread unfollowed"})
+}
+
+// respondThreadError maps thread errors to HTTP responses
+func respondThreadError(c *gin.Context, err error, fallback string) {
+	if permErr, ok := permission.AsError(err); ok {
+		response.Forbidden(c, permErr.Message)
+		return
+	}
+	switch {
+	case errors.Is(err, message.ErrMessageNotFound):
+		response.NotFound(c, "Message not found")
+	case errors.Is(err, message.ErrInvalidCursor):
+		response.BadRequest(c, "Invalid history cursor")
+	case errors.Is(err, message.ErrNotThreadable):
+		response.BadRequest(c, "Only group messages can have threads")
+	case errors.Is(err, message.ErrNestedThread):
+		response.BadRequest(c, "Thread replies cannot start threads")
+	case errors.Is(err, message.ErrMessageRecalled):
+		response.BadRequest(c, "Message has been recalled")
+	case errors.Is(err, message.ErrEmptyMessageContent):
+		response.BadRequest(c, "Message content cannot be empty")
+	default:
+		response.InternalError(c, fallback)
+	}
+}
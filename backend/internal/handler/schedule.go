@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/schedule"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/user"
+	"github.com/PlonGuo/GoChatroom/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleMessage schedules a message to be sent later
+func ScheduleMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	nickname, _ := c.Get("nickname")
+
+	var req schedule.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	avatar := ""
+	if u, err := user.GetByUUID(userID.(string)); err == nil {
+		avatar = u.Avatar
+	}
+
+	scheduled, err := schedule.Create(userID.(string), nickname.(string), avatar, req)
+	if err != nil {
+		if permErr, ok := permission.AsError(err); ok {
+			response.Forbidden(c, permErr.Message)
+			return
+		}
+		switch {
+		case errors.Is(err, upload.ErrInvalidAttachment):
+			response.BadRequest(c, "Invalid attachment: "+err.Error())
+		case errors.Is(err, schedule.ErrInvalidSendTime):
+			response.BadRequest(c, "Send time must be in the future and within a year")
+		case errors.Is(err, schedule.ErrEmptyMessage):
+			response.BadRequest(c, "Message content cannot be empty")
+		case errors.Is(err, schedule.ErrTooManyScheduled):
+			response.BadRequest(c, "Too many scheduled messages")
+		default:
+			response.InternalError(c, "Failed to schedule message")
+		}
+		return
+	}
+
+	response.Created(c, scheduled)
+}
+
+// GetScheduledMessages lists the current user's scheduled messages
+func GetScheduledMessages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	scheduled, err := schedule.List(userID.(string))
+	if err != nil {
+		response.InternalError(c, "Failed to get scheduled messages")
+		return
+	}
+
+	response.Success(c, scheduled)
+}
+
+// CancelScheduledMessage stops a scheduled message from being sent
+func CancelScheduledMessage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := schedule.Cancel(c.Param("uuid"), userID.(string)); err != nil {
+		switch {
+		case errors.Is(err, schedule.ErrScheduledNotFound):
+			response.NotFound(c, "Scheduled message not found")
+		case errors.Is(err, schedule.ErrNotPending):
+			response.BadRequest(c, "Scheduled message has already been sent or canceled")
+		default:
+			response.InternalError(c, "Failed to cancel scheduled message")
+		}
+		return
+	}
+
+	response.Success(c, gin.H{"message": "Scheduled message canceled"})
+}
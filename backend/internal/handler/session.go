@@ -3,6 +3,7 @@ package handler
 import (
 	"errors"
 
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
 	"github.com/PlonGuo/GoChatroom/backend/pkg/response"
 	"github.com/gin-gonic/gin"
@@ -44,6 +45,11 @@ func CreateSession(c *gin.Context) {
 	})
 }
 
+// MessageTTLRequest sets how long new messages in a conversation are kept
+type MessageTTLRequest struct {
+	TTLSeconds *int `json:"ttlSeconds" binding:"required"` // 0 keeps messages forever
+}
+
 // GetSessions returns all sessions for the current user
 func GetSessions(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -78,6 +84,7 @@ func GetSession(c *gin.Context) {
 		"avatar":      sess.Avatar,
 		"lastMessage": sess.LastMessage,
 		"unreadCount": sess.UnreadCount,
+		"messageTtl":  sess.MessageTTL,
 	})
 }
 
@@ -105,3 +112,38 @@ func ClearSessionUnread(c *gin.Context) {
 
 	response.Success(c, gin.H{"message": "Unread count cleared"})
 }
+
+// SetSessionMessageTTL sets the retention period of a direct chat
+func SetSessionMessageTTL(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uuid := c.Param("uuid")
+
+	var req MessageTTLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	sess, err := session.SetMessageTTL(uuid, userID.(string), *req.TTLSeconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, session.ErrSessionNotFound):
+			response.NotFound(c, "Session not found")
+		case errors.Is(err, session.ErrInvalidMessageTTL):
+			response.BadRequest(c, "Message retention must be 0 or between one minute and one year")
+		case errors.Is(err, session.ErrGroupSession):
+			response.BadRequest(c, "Group message retention is set on the group")
+		default:
+			response.InternalError(c, "Failed to set message retention")
+		}
+		return
+	}
+
+	chat.GetHub().NotifyMessageTTL(sess.SendID, sess.ReceiveID, sess.MessageTTL)
+
+	response.Success(c, gin.H{
+		"uuid":       sess.UUID,
+		"receiveId":  sess.ReceiveID,
+		"messageTtl": sess.MessageTTL,
+	})
+}
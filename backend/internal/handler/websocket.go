@@ -3,6 +3,7 @@ package handler
 import (
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/user"
@@ -53,9 +54,9 @@ func WebSocketHandler(c *gin.Context) {
 		return
 	}
 
-	// Create client and start handling
+	// Create client and start handling; each device gets its own connection
 	hub := chat.GetHub()
-	chat.NewClient(hub, conn, claims.UserID, userModel.Nickname, userModel.Avatar)
+	chat.NewClient(hub, conn, claims.UserID, userModel.Nickname, userModel.Avatar, c.Query("device"))
 }
 
 // GetOnlineUsers returns the list of online users
@@ -73,6 +74,36 @@ func CheckUserOnline(c *gin.Context) {
 	response.Success(c, gin.H{"online": online})
 }
 
+// SyncEvents returns the events the current user missed after a given sequence number
+func SyncEvents(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var since int64
+	if s := c.Query("since"); s != "" {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || parsed < 0 {
+			response.BadRequest(c, "Invalid since parameter")
+			return
+		}
+		since = parsed
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	result, err := chat.GetEventsSince(userID.(string), since, limit)
+	if err != nil {
+		response.InternalError(c, "Failed to sync events")
+		return
+	}
+
+	response.Success(c, result)
+}
+
 // WebRTCSignalingHandler handles WebRTC signaling WebSocket connections
 func WebRTCSignalingHandler(c *gin.Context) {
 	// Get token from query parameter
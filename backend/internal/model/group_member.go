@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// GroupMember is a user's membership in a group
+type GroupMember struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID   string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_group_members_group_user,priority:1" json:"groupId"` // Group UUID
+	UserID    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_group_members_group_user,priority:2;index" json:"userId"`
+	Role      int8      `gorm:"type:smallint;default:0" json:"role"` // 0: member, 1: admin, 2: owner
+	Nickname  string    `gorm:"type:varchar(50)" json:"nickname"`    // Name shown in this group; empty uses the profile nickname
+	JoinedAt  time.Time `json:"joinedAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GroupMember model
+func (GroupMember) TableName() string {
+	return "group_members"
+}
+
+// GroupRole constants, ordered so a higher role can manage a lower one
+const (
+	GroupRoleMember = 0
+	GroupRoleAdmin  = 1
+	GroupRoleOwner  = 2
+)
@@ -10,20 +10,55 @@ type Message struct {
 	ID         int64        `gorm:"primaryKey;autoIncrement" json:"id"`
 	UUID       string       `gorm:"type:varchar(20);uniqueIndex;not null" json:"uuid"`
 	SessionID  string       `gorm:"type:varchar(20);not null;index" json:"sessionId"`
-	Type       int8         `gorm:"type:smallint;default:0" json:"type"`                 // 0: text, 1: voice, 2: file, 3: image, 4: video call
+	Type       int8         `gorm:"type:smallint;default:0" json:"type"` // 0: text, 1: voice, 2: file, 3: image, 4: video call
 	Content    string       `gorm:"type:text" json:"content"`
-	URL        string       `gorm:"type:varchar(255)" json:"url"`                       // File/media URL
-	SendID     string       `gorm:"type:varchar(20);not null;index" json:"sendId"`
+	URL        string       `gorm:"type:varchar(255)" json:"url"` // File/media URL
+	SendID     string       `gorm:"type:varchar(20);not null;index;uniqueIndex:idx_messages_client_msg,priority:1" json:"sendId"`
 	SendName   string       `gorm:"type:varchar(50)" json:"sendName"`
 	SendAvatar string       `gorm:"type:varchar(255)" json:"sendAvatar"`
 	ReceiveID  string       `gorm:"type:varchar(20);not null;index" json:"receiveId"`
 	FileType   string       `gorm:"type:varchar(20)" json:"fileType,omitempty"`
 	FileName   string       `gorm:"type:varchar(100)" json:"fileName,omitempty"`
 	FileSize   int64        `json:"fileSize,omitempty"`
-	Status     int8         `gorm:"type:smallint;default:0" json:"status"`               // 0: sent, 1: delivered, 2: read
-	AVData     string       `gorm:"type:text" json:"avData,omitempty"`                  // WebRTC signaling data
+	Status     int8         `gorm:"type:smallint;default:0" json:"status"` // 0: sent, 1: delivered, 2: read
+	AVData     string       `gorm:"type:text" json:"avData,omitempty"`     // WebRTC signaling data
 	CreatedAt  time.Time    `gorm:"index" json:"createdAt"`
 	SentAt     sql.NullTime `json:"sentAt"`
+
+	// Voice message length and waveform, copied from the attached upload
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Waveform   string `gorm:"type:varchar(128)" json:"-"` // Base64 amplitudes, see media.EncodeWaveform
+
+	// Preview of the first link in a text message, filled in after sending
+	LinkPreview string `gorm:"type:text" json:"-"` // JSON, see linkpreview.Preview
+
+	// Group members called out with @mentions
+	Mentions   string `gorm:"type:text" json:"-"` // JSON array of user IDs
+	MentionAll bool   `gorm:"default:false" json:"mentionAll,omitempty"`
+
+	// Original message and author credited by a forwarded message
+	ForwardedFromID   string `gorm:"type:varchar(20)" json:"forwardedFromId,omitempty"` // Message UUID
+	ForwardedFromUser string `gorm:"type:varchar(20)" json:"forwardedFromUser,omitempty"`
+	ForwardedFromName string `gorm:"type:varchar(50)" json:"forwardedFromName,omitempty"`
+
+	// Root message UUID when this is a reply inside a thread; such replies are
+	// left out of the main timeline
+	ThreadID string `gorm:"type:varchar(20);default:'';index" json:"threadId,omitempty"`
+
+	// Message this one replies to, if any
+	ReplyToID string `gorm:"type:varchar(20);index" json:"replyToId,omitempty"`
+
+	// Edit and recall state
+	EditedAt        sql.NullTime `json:"editedAt"`
+	OriginalContent string       `gorm:"type:text" json:"-"` // Content before the first edit
+	Recalled        bool         `gorm:"default:false" json:"recalled"`
+	RecalledAt      sql.NullTime `json:"recalledAt"`
+
+	// When the conversation's retention period runs out; NULL keeps the message
+	ExpiresAt sql.NullTime `gorm:"index" json:"expiresAt"`
+
+	// Client-generated ID, unique per sender; NULL when the client supplied none
+	ClientMsgID *string `gorm:"type:varchar(64);uniqueIndex:idx_messages_client_msg,priority:2" json:"clientMsgId,omitempty"`
 }
 
 // TableName specifies the table name for Message model
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Pin is a message pinned to the top of a conversation
+type Pin struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConversationID string    `gorm:"type:varchar(41);not null;uniqueIndex:idx_pins_conversation_message,priority:1" json:"conversationId"`  // Group UUID, or both user UUIDs of a direct chat
+	MessageID      string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_pins_conversation_message,priority:2;index" json:"messageId"` // Message UUID
+	PinnedBy       string    `gorm:"type:varchar(20);not null" json:"pinnedBy"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for Pin model
+func (Pin) TableName() string {
+	return "pins"
+}
+
+// PinLock is one row per conversation that has had a pin. Pinning locks it,
+// so concurrent pins are checked against the limit one at a time.
+type PinLock struct {
+	ConversationID string `gorm:"type:varchar(41);primaryKey" json:"conversationId"`
+}
+
+// TableName specifies the table name for PinLock model
+func (PinLock) TableName() string {
+	return "pin_locks"
+}
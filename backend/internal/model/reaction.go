@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Reaction is an emoji a user attached to a message
+type Reaction struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_reactions_message_user_emoji,priority:1" json:"messageId"` // Message UUID
+	UserID    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_reactions_message_user_emoji,priority:2" json:"userId"`
+	Emoji     string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_reactions_message_user_emoji,priority:3" json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for Reaction model
+func (Reaction) TableName() string {
+	return "reactions"
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ScheduledMessage is a message composed now and sent at SendAt
+type ScheduledMessage struct {
+	ID         int64        `gorm:"primaryKey;autoIncrement" json:"id"`
+	UUID       string       `gorm:"type:varchar(20);uniqueIndex;not null" json:"uuid"`
+	SendID     string       `gorm:"type:varchar(20);not null;index" json:"sendId"`
+	SendName   string       `gorm:"type:varchar(50)" json:"sendName"`
+	SendAvatar string       `gorm:"type:varchar(255)" json:"sendAvatar"`
+	ReceiveID  string       `gorm:"type:varchar(20);not null" json:"receiveId"`
+	SessionID  string       `gorm:"type:varchar(20)" json:"sessionId"`
+	Type       int8         `gorm:"type:smallint;default:0" json:"type"`
+	Content    string       `gorm:"type:text" json:"content"`
+	URL        string       `gorm:"type:varchar(255)" json:"url,omitempty"`
+	ReplyToID  string       `gorm:"type:varchar(20)" json:"replyToId,omitempty"`
+	Mentions   string       `gorm:"type:text" json:"-"` // JSON array of user IDs
+	SendAt     time.Time    `gorm:"not null;index:idx_scheduled_status_send_at,priority:2" json:"sendAt"`
+	Status     int8         `gorm:"type:smallint;default:0;index:idx_scheduled_status_send_at,priority:1" json:"status"` // 0: pending, 1: sending, 2: sent, 3: failed, 4: canceled
+	MessageID  string       `gorm:"type:varchar(20)" json:"messageId,omitempty"`                                         // UUID of the sent message
+	Error      string       `gorm:"type:varchar(255)" json:"error,omitempty"`                                            // Why sending failed
+	Attempts   int          `gorm:"default:0" json:"-"`                                                                  // Sends that failed and were retried
+	RetryAt    sql.NullTime `json:"-"`                                                                                   // When a failed send is tried again
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
+
+// TableName specifies the table name for ScheduledMessage model
+func (ScheduledMessage) TableName() string {
+	return "scheduled_messages"
+}
+
+// ScheduledStatus constants
+const (
+	ScheduledStatusPending  = 0
+	ScheduledStatusSending  = 1
+	ScheduledStatusSent     = 2
+	ScheduledStatusFailed   = 3
+	ScheduledStatusCanceled = 4
+)
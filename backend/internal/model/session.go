@@ -11,13 +11,16 @@ import (
 type Session struct {
 	ID            int64          `gorm:"primaryKey;autoIncrement" json:"id"`
 	UUID          string         `gorm:"type:varchar(20);uniqueIndex;not null" json:"uuid"`
-	SendID        string         `gorm:"type:varchar(20);not null;index" json:"sendId"`       // Session owner (viewer)
-	ReceiveID     string         `gorm:"type:varchar(20);not null;index" json:"receiveId"`    // Contact UUID (user or group)
-	ReceiveName   string         `gorm:"type:varchar(50)" json:"receiveName"`              // Display name
+	SendID        string         `gorm:"type:varchar(20);not null;index;uniqueIndex:idx_sessions_owner_receiver,priority:1" json:"sendId"`    // Session owner (viewer)
+	ReceiveID     string         `gorm:"type:varchar(20);not null;index;uniqueIndex:idx_sessions_owner_receiver,priority:2" json:"receiveId"` // Contact UUID (user or group)
+	ReceiveName   string         `gorm:"type:varchar(50)" json:"receiveName"`                                                                 // Display name
 	Avatar        string         `gorm:"type:varchar(255);default:'https://api.dicebear.com/7.x/avataaars/svg'" json:"avatar"`
 	LastMessage   string         `gorm:"type:text" json:"lastMessage"`
 	LastMessageAt sql.NullTime   `json:"lastMessageAt"`
 	UnreadCount   int            `gorm:"default:0" json:"unreadCount"`
+	LastReadID    int64          `gorm:"default:0" json:"-"`             // ID of the newest message the owner has read
+	Mentioned     bool           `gorm:"default:false" json:"mentioned"` // Owner was mentioned since last reading
+	MessageTTL    int            `gorm:"default:0" json:"messageTtl"`    // Seconds new direct messages are kept; 0 keeps them forever
 	CreatedAt     time.Time      `gorm:"index" json:"createdAt"`
 	UpdatedAt     time.Time      `json:"updatedAt"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
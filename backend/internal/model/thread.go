@@ -0,0 +1,38 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Thread tracks the replies to a group message that became a thread root
+type Thread struct {
+	ID            int64        `gorm:"primaryKey;autoIncrement" json:"id"`
+	RootID        string       `gorm:"type:varchar(20);uniqueIndex;not null" json:"rootId"` // Root message UUID
+	GroupID       string       `gorm:"type:varchar(20);not null;index" json:"groupId"`
+	ReplyCount    int          `gorm:"default:0" json:"replyCount"`
+	LastReplyID   string       `gorm:"type:varchar(20)" json:"lastReplyId"`
+	LastReplyBy   string       `gorm:"type:varchar(20)" json:"lastReplyBy"`
+	LastReplyName string       `gorm:"type:varchar(50)" json:"lastReplyName"`
+	LastReplyAt   sql.NullTime `json:"lastReplyAt"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+}
+
+// TableName specifies the table name for Thread model
+func (Thread) TableName() string {
+	return "threads"
+}
+
+// ThreadFollower is a user who gets new replies in a thread
+type ThreadFollower struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	RootID    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_thread_followers_root_user,priority:1" json:"rootId"` // Root message UUID
+	UserID    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_thread_followers_root_user,priority:2;index" json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for ThreadFollower model
+func (ThreadFollower) TableName() string {
+	return "thread_followers"
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Upload is a file stored by the upload service and referenced by messages through its URL
+type Upload struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UUID       string    `gorm:"type:varchar(20);uniqueIndex;not null" json:"uuid"`
+	OwnerID    string    `gorm:"type:varchar(20);not null;index" json:"ownerId"`
+	StorageKey string    `gorm:"type:varchar(255);not null" json:"-"`
+	FileName   string    `gorm:"type:varchar(100)" json:"fileName"`
+	MimeType   string    `gorm:"type:varchar(100)" json:"mimeType"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"createdAt"`
+
+	// Media metadata, filled in by the background media worker
+	MediaStatus  int8   `gorm:"type:smallint;default:0" json:"mediaStatus"` // 0: none, 1: pending, 2: ready, 3: failed
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	BlurHash     string `gorm:"type:varchar(64)" json:"blurHash,omitempty"`
+	ThumbnailKey string `gorm:"type:varchar(255)" json:"-"`
+
+	// Audio metadata, extracted when the file is stored
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Waveform   string `gorm:"type:varchar(128)" json:"-"` // Base64 amplitudes, see media.EncodeWaveform
+}
+
+// TableName specifies the table name for Upload model
+func (Upload) TableName() string {
+	return "uploads"
+}
+
+// MediaStatus constants
+const (
+	MediaStatusNone    = 0
+	MediaStatusPending = 1
+	MediaStatusReady   = 2
+	MediaStatusFailed  = 3
+)
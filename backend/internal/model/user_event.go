@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// UserEvent is a durable copy of a WebSocket event addressed to a user, kept
+// so clients that were offline can catch up. Seq is the sync sequence number,
+// allocated per user from UserEventSeq.
+type UserEvent struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_user_events_user_sequence,priority:1" json:"userId"`
+	Seq       int64     `gorm:"not null;default:0;uniqueIndex:idx_user_events_user_sequence,priority:2" json:"seq"`
+	Type      string    `gorm:"type:varchar(50);not null" json:"type"`
+	Payload   string    `gorm:"type:text" json:"payload"`                          // JSON-encoded event data
+	MessageID string    `gorm:"type:varchar(20);index" json:"messageId,omitempty"` // Message the event is about, if any
+	QuotedID  string    `gorm:"type:varchar(20);index" json:"quotedId,omitempty"`  // Message quoted by the reply the event carries, if any
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+// TableName specifies the table name for UserEvent model
+func (UserEvent) TableName() string {
+	return "user_events"
+}
+
+// UserEventSeq holds the last sequence number given to one of a user's events.
+// Its row is locked while an event is stored, so each user's events commit in
+// sequence order.
+type UserEventSeq struct {
+	UserID string `gorm:"type:varchar(20);primaryKey" json:"userId"`
+	Seq    int64  `gorm:"not null;default:0" json:"seq"`
+}
+
+// TableName specifies the table name for UserEventSeq model
+func (UserEventSeq) TableName() string {
+	return "user_event_seqs"
+}
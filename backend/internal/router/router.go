@@ -69,11 +69,15 @@ func Setup(r *gin.Engine) {
 				groups.GET("/my", handler.GetMyGroups)
 				groups.GET("/:uuid", handler.GetGroup)
 				groups.PUT("/:uuid", handler.UpdateGroup)
+				groups.PUT("/:uuid/ttl", handler.SetGroupMessageTTL)
 				groups.DELETE("/:uuid", handler.DissolveGroup)
 				groups.GET("/:uuid/members", handler.GetGroupMembers)
 				groups.POST("/:uuid/join", handler.JoinGroup)
 				groups.POST("/:uuid/leave", handler.LeaveGroup)
 				groups.DELETE("/:uuid/members/:memberUuid", handler.KickMember)
+				groups.POST("/:uuid/admins/:memberUuid", handler.PromoteAdmin)
+				groups.DELETE("/:uuid/admins/:memberUuid", handler.DemoteAdmin)
+				groups.PUT("/:uuid/nickname", handler.SetGroupNickname)
 			}
 
 			// Contact/Friend management
@@ -103,21 +107,51 @@ func Setup(r *gin.Engine) {
 				sessions.GET("/:uuid", handler.GetSession)
 				sessions.DELETE("/:uuid", handler.DeleteSession)
 				sessions.POST("/:uuid/read", handler.ClearSessionUnread)
+				sessions.PUT("/:uuid/ttl", handler.SetSessionMessageTTL)
 			}
 
 			// Message management
 			messages := protected.Group("/messages")
 			{
 				messages.POST("", handler.SendMessage)
+				messages.POST("/forward", handler.ForwardMessages)
+				messages.POST("/scheduled", handler.ScheduleMessage)
+				messages.GET("/scheduled", handler.GetScheduledMessages)
+				messages.DELETE("/scheduled/:uuid", handler.CancelScheduledMessage)
 				messages.GET("", handler.GetMessages)
+				messages.GET("/search", handler.SearchMessages)
+				messages.GET("/pins", handler.GetPins)
+				messages.PUT("/:uuid", handler.EditMessage)
+				messages.POST("/:uuid/recall", handler.RecallMessage)
+				messages.POST("/:uuid/reactions", handler.AddReaction)
+				messages.DELETE("/:uuid/reactions", handler.RemoveReaction)
 				messages.POST("/:uuid/read", handler.MarkAsRead)
+				messages.GET("/:uuid/receipts", handler.GetReadReceipts)
+				messages.POST("/:uuid/pin", handler.PinMessage)
+				messages.DELETE("/:uuid/pin", handler.UnpinMessage)
+				messages.GET("/:uuid/thread", handler.GetThread)
+				messages.POST("/:uuid/thread", handler.ReplyInThread)
+				messages.POST("/:uuid/thread/follow", handler.FollowThread)
+				messages.DELETE("/:uuid/thread/follow", handler.UnfollowThread)
 				messages.POST("/sessions/:sessionId/read-all", handler.MarkAllAsRead)
 				messages.GET("/unread-count", handler.GetUnreadCount)
 			}
 
+			// File uploads and downloads
+			files := protected.Group("/files")
+			{
+				files.POST("", handler.UploadFile)
+				files.GET("/:uuid", handler.DownloadFile)
+				files.GET("/:uuid/thumbnail", handler.DownloadThumbnail)
+				files.POST("/:uuid/thumbnail", handler.RegenerateThumbnail)
+			}
+
 			// Online status
 			protected.GET("/online", handler.GetOnlineUsers)
 			protected.GET("/online/:uuid", handler.CheckUserOnline)
+
+			// Missed event sync
+			protected.GET("/sync", handler.SyncEvents)
 		}
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -30,10 +31,21 @@ type Client struct {
 	userID   string
 	nickname string
 	avatar   string
+	connID   string // Unique per connection
+	deviceID string // Client-supplied device label, defaults to connID
+
+	// Limits how fast this connection may send ephemeral events
+	ephemeralLimit *rateLimiter
 }
 
-// NewClient creates a new client and registers it with the hub
-func NewClient(hub *Hub, conn *websocket.Conn, userID, nickname, avatar string) {
+// NewClient creates a new client and registers it with the hub.
+// A user may hold several clients at once, one per device.
+func NewClient(hub *Hub, conn *websocket.Conn, userID, nickname, avatar, deviceID string) {
+	connID := "C" + uuid.New().String()[:11]
+	if deviceID == "" {
+		deviceID = connID
+	}
+
 	client := &Client{
 		hub:      hub,
 		conn:     conn,
@@ -41,6 +53,10 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID, nickname, avatar string)
 		userID:   userID,
 		nickname: nickname,
 		avatar:   avatar,
+		connID:   connID,
+		deviceID: deviceID,
+
+		ephemeralLimit: newRateLimiter(ephemeralBurst, ephemeralWindow),
 	}
 
 	// Register client with hub
@@ -81,10 +97,28 @@ func (c *Client) readPump() {
 			continue
 		}
 
+		switch wsMsg.Action {
+		case "", ActionSend:
+		case ActionSync:
+			c.sync(wsMsg.LastSeq)
+			continue
+		case ActionTypingStart, ActionTypingStop:
+			c.relayEphemeral(&wsMsg)
+			continue
+		default:
+			c.hub.sendToClient(c, WSResponse{
+				Type:      "error",
+				Data:      map[string]string{"message": "Unknown action: " + wsMsg.Action},
+				Timestamp: time.Now().Unix(),
+			})
+			continue
+		}
+
 		// Set sender info
 		wsMsg.SendID = c.userID
 		wsMsg.SendName = c.nickname
 		wsMsg.SendAvatar = c.avatar
+		wsMsg.client = c
 
 		// Send to hub for processing
 		c.hub.broadcast <- &wsMsg
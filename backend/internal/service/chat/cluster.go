@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+)
+
+const (
+	// Presence entries not refreshed within this window are considered stale
+	presenceTTL = 90 * time.Second
+
+	// How often a node re-announces the users connected to it
+	presenceRefreshPeriod = 30 * time.Second
+
+	// Sorted set of online user IDs, scored by last refresh time
+	onlineUsersKey = "chat:online"
+
+	// Hash per user mapping node ID -> last refresh time
+	presenceKeyPrefix = "chat:presence:"
+
+	// Pub/sub channel per node carrying deliveries for its local clients
+	nodeChannelPrefix = "chat:node:"
+)
+
+// relayEnvelope carries already-encoded responses to users connected to another node
+type relayEnvelope struct {
+	Deliveries []relayDelivery `json:"deliveries"`
+}
+
+// relayDelivery is a single user's encoded response
+type relayDelivery struct {
+	UserID  string          `json:"userId"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// clusterEnabled reports whether Redis is available for cross-node delivery
+func clusterEnabled() bool {
+	return redis.GetClient() != nil
+}
+
+func presenceKey(userID string) string {
+	return presenceKeyPrefix + userID
+}
+
+func nodeChannel(nodeID string) string {
+	return nodeChannelPrefix + nodeID
+}
+
+// markOnline records that a user is connected to this node
+func (h *Hub) markOnline(userID string) {
+	if !clusterEnabled() {
+		return
+	}
+
+	now := time.Now().Unix()
+	key := presenceKey(userID)
+	if err := redis.SetHash(key, h.nodeID, strconv.FormatInt(now, 10)); err != nil {
+		log.Printf("Failed to update presence for %s: %v", userID, err)
+		return
+	}
+	redis.Expire(key, presenceTTL)
+	redis.AddSorted(onlineUsersKey, userID, float64(now))
+}
+
+// markOffline removes this node from a user's presence, and the user from the
+// online set once no node holds a connection for them
+func (h *Hub) markOffline(userID string) {
+	if !clusterEnabled() {
+		return
+	}
+
+	key := presenceKey(userID)
+	if err := redis.DeleteHash(key, h.nodeID); err != nil {
+		log.Printf("Failed to clear presence for %s: %v", userID, err)
+		return
+	}
+	if n, err := redis.HashLen(key); err == nil && n == 0 {
+		redis.RemoveSorted(onlineUsersKey, userID)
+	}
+}
+
+// refreshPresence re-announces every local user so their entries don't expire
+func (h *Hub) refreshPresence() {
+	for _, userID := range h.localUsers() {
+		h.markOnline(userID)
+	}
+}
+
+// remoteNodes groups users by the other nodes they are connected to
+func (h *Hub) remoteNodes(userIDs []string) map[string][]string {
+	nodes := make(map[string][]string)
+	if !clusterEnabled() || len(userIDs) == 0 {
+		return nodes
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = presenceKey(userID)
+	}
+
+	hashes, err := redis.GetAllHashes(keys)
+	if err != nil {
+		log.Printf("Failed to look up presence: %v", err)
+		return nodes
+	}
+
+	cutoff := time.Now().Add(-presenceTTL).Unix()
+	for i, presence := range hashes {
+		for nodeID, seen := range presence {
+			if nodeID == h.nodeID {
+				continue
+			}
+			if ts, err := strconv.ParseInt(seen, 10, 64); err != nil || ts < cutoff {
+				continue
+			}
+			nodes[nodeID] = append(nodes[nodeID], userIDs[i])
+		}
+	}
+	return nodes
+}
+
+// relay forwards encoded responses, keyed by user, to users connected to other nodes
+func (h *Hub) relay(payloads map[string][]byte) {
+	userIDs := make([]string, 0, len(payloads))
+	for userID := range payloads {
+		userIDs = append(userIDs, userID)
+	}
+
+	for nodeID, users := range h.remoteNodes(userIDs) {
+		deliveries := make([]relayDelivery, len(users))
+		for i, userID := range users {
+			deliveries[i] = relayDelivery{UserID: userID, Payload: payloads[userID]}
+		}
+
+		envelope, err := json.Marshal(relayEnvelope{Deliveries: deliveries})
+		if err != nil {
+			log.Printf("Failed to marshal relay envelope: %v", err)
+			return
+		}
+		if err := redis.Publish(nodeChannel(nodeID), envelope); err != nil {
+			log.Printf("Failed to relay to node %s: %v", nodeID, err)
+		}
+	}
+}
+
+// subscribe delivers responses relayed by other nodes to local clients
+func (h *Hub) subscribe() {
+	if !clusterEnabled() {
+		return
+	}
+
+	pubsub := redis.Subscribe(nodeChannel(h.nodeID))
+	defer pubsub.Close()
+	log.Printf("Chat node %s subscribed for relayed messages", h.nodeID)
+
+	for msg := range pubsub.Channel() {
+		var envelope relayEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			log.Printf("Failed to parse relay envelope: %v", err)
+			continue
+		}
+		responses := make(map[string]WSResponse)
+		var delivered []string
+		for _, d := range envelope.Deliveries {
+			if !h.deliverLocal(d.UserID, d.Payload) {
+				continue
+			}
+			var response WSResponse
+			if err := json.Unmarshal(d.Payload, &response); err == nil {
+				responses[d.UserID] = response
+				delivered = append(delivered, d.UserID)
+			}
+		}
+		h.recordDeliveries(responses, delivered)
+	}
+}
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+)
+
+const (
+	// Each connection may send at most ephemeralBurst ephemeral events per ephemeralWindow
+	ephemeralBurst  = 10
+	ephemeralWindow = 5 * time.Second
+)
+
+// rateLimiter is a fixed-window counter. It is only used from a client's read
+// goroutine, so it needs no locking.
+type rateLimiter struct {
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	count       int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window}
+}
+
+// allow reports whether another event fits in the current window
+func (l *rateLimiter) allow(now time.Time) bool {
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.count = 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// relayEphemeral forwards a typing indicator to the conversation peer, or to
+// the other online group members. Nothing is stored; events over the rate
+// limit or to conversations the sender can't post in are dropped.
+func (c *Client) relayEphemeral(msg *WSMessage) {
+	if msg.ReceiveID == "" || !c.ephemeralLimit.allow(time.Now()) {
+		return
+	}
+
+	if err := permission.CanSend(c.userID, msg.ReceiveID, ""); err != nil {
+		if _, ok := permission.AsError(err); !ok {
+			log.Printf("Failed to check ephemeral event permission: %v", err)
+		}
+		return
+	}
+
+	recipients := []string{msg.ReceiveID}
+	if session.IsGroupID(msg.ReceiveID) {
+		members, err := groupMembers(msg.ReceiveID)
+		if err != nil {
+			log.Printf("Failed to get group members: %v", err)
+			return
+		}
+		recipients = excludeUser(members, c.userID)
+	}
+
+	c.hub.SendToUsers(recipients, WSResponse{
+		Type: msg.Action,
+		Data: map[string]interface{}{
+			"sendId":    c.userID,
+			"sendName":  c.nickname,
+			"receiveId": msg.ReceiveID,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// excludeUser returns userIDs without userID
+func excludeUser(userIDs []string, userID string) []string {
+	result := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != userID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_FixedWindow(t *testing.T) {
+	limiter := newRateLimiter(2, time.Second)
+	start := time.Unix(1000, 0)
+
+	assert.True(t, limiter.allow(start))
+	assert.True(t, limiter.allow(start.Add(100*time.Millisecond)))
+	assert.False(t, limiter.allow(start.Add(500*time.Millisecond)))
+
+	// A new window resets the count
+	assert.True(t, limiter.allow(start.Add(time.Second)))
+}
+
+func TestTypingEvents_NotStored(t *testing.T) {
+	assert.True(t, ephemeralEvents[ActionTypingStart])
+	assert.True(t, ephemeralEvents[ActionTypingStop])
+}
+
+func TestExcludeUser(t *testing.T) {
+	assert.Equal(t, []string{"Ubob", "Ucarol"}, excludeUser([]string{"Ualice", "Ubob", "Ucarol"}, "Ualice"))
+	assert.Empty(t, excludeUser([]string{"Ualice"}, "Ualice"))
+}
@@ -0,0 +1,305 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Default and maximum number of events returned by one sync call
+	defaultSyncLimit = 200
+	maxSyncLimit     = 1000
+
+	// Events older than this are pruned; clients further behind must reload via REST
+	eventRetention = 7 * 24 * time.Hour
+
+	// How often old events are pruned
+	eventPrunePeriod = time.Hour
+)
+
+// ephemeralEvents are delivered only to connected clients and never stored
+var ephemeralEvents = map[string]bool{
+	"system":        true,
+	"error":         true,
+	"sync_complete": true,
+	"ack":           true,
+	"nack":          true,
+	"typing_start":  true,
+	"typing_stop":   true,
+}
+
+// SyncResult contains events a client missed since its last seen sequence
+type SyncResult struct {
+	Events  []WSResponse `json:"events"`
+	LastSeq int64        `json:"lastSeq"`
+	HasMore bool         `json:"hasMore"`
+}
+
+// isDurable reports whether a response should be kept in the event log
+func isDurable(response WSResponse) bool {
+	return !ephemeralEvents[response.Type] && database.DB != nil
+}
+
+// appendEvents stores each user's durable response in their event log and
+// returns the sequence number assigned to each user
+func appendEvents(responses map[string]WSResponse) map[string]int64 {
+	seqs := make(map[string]int64, len(responses))
+
+	events := make([]model.UserEvent, 0, len(responses))
+	for userID, response := range responses {
+		if !isDurable(response) {
+			continue
+		}
+		payload, err := json.Marshal(response.Data)
+		if err != nil {
+			log.Printf("Failed to marshal event payload: %v", err)
+			continue
+		}
+		messageID, quotedID := eventRefs(payload)
+		events = append(events, model.UserEvent{
+			UserID:    userID,
+			Type:      response.Type,
+			Payload:   string(payload),
+			MessageID: messageID,
+			QuotedID:  quotedID,
+		})
+	}
+	if len(events) == 0 {
+		return seqs
+	}
+
+	userIDs := make([]string, len(events))
+	for i, e := range events {
+		userIDs[i] = e.UserID
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		next, err := nextSeqs(tx, userIDs)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			events[i].Seq = next[events[i].UserID]
+		}
+		return tx.CreateInBatches(&events, 100).Error
+	})
+	if err != nil {
+		log.Printf("Failed to store events: %v", err)
+		return seqs
+	}
+
+	for _, e := range events {
+		seqs[e.UserID] = e.Seq
+	}
+	return seqs
+}
+
+// nextSeqs reserves the next sequence number of each user. Their counter rows
+// stay locked until the transaction commits, so a user's events become visible
+// in sequence order and a sync can't move past one that is still being stored.
+func nextSeqs(tx *gorm.DB, userIDs []string) (map[string]int64, error) {
+	// Lock in a fixed order so overlapping group sends can't deadlock
+	sort.Strings(userIDs)
+
+	counters := make([]model.UserEventSeq, len(userIDs))
+	for i, userID := range userIDs {
+		counters[i] = model.UserEventSeq{UserID: userID}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counters).Error; err != nil {
+		return nil, err
+	}
+
+	var locked []model.UserEventSeq
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id IN ?", userIDs).
+		Order("user_id ASC").
+		Find(&locked).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&model.UserEventSeq{}).Where("user_id IN ?", userIDs).
+		Update("seq", gorm.Expr("seq + 1")).Error; err != nil {
+		return nil, err
+	}
+
+	seqs := make(map[string]int64, len(locked))
+	for _, c := range locked {
+		seqs[c.UserID] = c.Seq + 1
+	}
+	return seqs, nil
+}
+
+// eventRefs returns the UUID of the message an event payload is about and of
+// the message quoted by the reply it carries. Message events name it "uuid";
+// reaction and pin events name it "messageId", and a pin event embeds its quote.
+func eventRefs(payload []byte) (messageID, quotedID string) {
+	var ref struct {
+		UUID      string `json:"uuid"`
+		MessageID string `json:"messageId"`
+		ReplyTo   struct {
+			UUID string `json:"uuid"`
+		} `json:"replyTo"`
+	}
+	if err := json.Unmarshal(payload, &ref); err != nil {
+		return "", ""
+	}
+	if isMessageID(ref.UUID) {
+		messageID = ref.UUID
+	} else if isMessageID(ref.MessageID) {
+		messageID = ref.MessageID
+	}
+	if isMessageID(ref.ReplyTo.UUID) {
+		quotedID = ref.ReplyTo.UUID
+	}
+	return messageID, quotedID
+}
+
+func isMessageID(uuid string) bool {
+	return strings.HasPrefix(uuid, "M")
+}
+
+// ForgetMessages removes messages whose content has been removed from stored
+// events, so a later sync can't replay it: events about them are deleted, and
+// replies quoting them lose the quote, as if it could no longer be loaded.
+func ForgetMessages(tx *gorm.DB, uuids []string) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+	if err := tx.Where("message_id IN ?", uuids).Delete(&model.UserEvent{}).Error; err != nil {
+		return err
+	}
+
+	var events []model.UserEvent
+	return tx.Select("id", "payload").Where("quoted_id IN ?", uuids).
+		FindInBatches(&events, 500, func(*gorm.DB, int) error {
+			for _, e := range events {
+				if err := tx.Model(&model.UserEvent{}).Where("id = ?", e.ID).Updates(map[string]interface{}{
+					"payload":   withoutQuote(e.Payload),
+					"quoted_id": "",
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// withoutQuote drops the replied-to preview from a stored event payload,
+// keeping replyToId. A payload it can't parse is emptied rather than kept.
+func withoutQuote(payload string) string {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		return "{}"
+	}
+	delete(data, "replyTo")
+	redacted, err := json.Marshal(data)
+	if err != nil {
+		return "{}"
+	}
+	return string(redacted)
+}
+
+// GetEventsSince returns a user's events with a sequence number greater than lastSeq
+func GetEventsSince(userID string, lastSeq int64, limit int) (*SyncResult, error) {
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	var events []model.UserEvent
+	if err := database.DB.Where("user_id = ? AND seq > ?", userID, lastSeq).
+		Order("seq ASC").
+		Limit(limit + 1).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{LastSeq: lastSeq}
+	if len(events) > limit {
+		events = events[:limit]
+		result.HasMore = true
+	}
+
+	result.Events = make([]WSResponse, 0, len(events))
+	for _, e := range events {
+		result.Events = append(result.Events, WSResponse{
+			Type:      e.Type,
+			Data:      json.RawMessage(e.Payload),
+			Timestamp: e.CreatedAt.Unix(),
+			Seq:       e.Seq,
+		})
+		result.LastSeq = e.Seq
+	}
+
+	return result, nil
+}
+
+// pruneEvents deletes events past the retention window
+func pruneEvents() {
+	if database.DB == nil {
+		return
+	}
+	cutoff := time.Now().Add(-eventRetention)
+	if err := database.DB.Where("created_at < ?", cutoff).Delete(&model.UserEvent{}).Error; err != nil {
+		log.Printf("Failed to prune events: %v", err)
+	}
+}
+
+// sync replays missed events to this connection only, followed by a sync_complete marker.
+// It runs on the read goroutine, so the client cannot be unregistered meanwhile.
+func (c *Client) sync(lastSeq int64) {
+	result, err := GetEventsSince(c.userID, lastSeq, defaultSyncLimit)
+	if err != nil {
+		log.Printf("Failed to sync events for %s: %v", c.userID, err)
+		c.hub.sendToClient(c, WSResponse{
+			Type:      "error",
+			Data:      map[string]string{"message": "Failed to sync events"},
+			Timestamp: time.Now().Unix(),
+		})
+		return
+	}
+
+	for _, event := range result.Events {
+		if !c.queue(event) {
+			return
+		}
+		if uuid, sendID := messageRef(event); uuid != "" && sendID != c.userID {
+			c.hub.recordDelivery(uuid, c.userID)
+		}
+	}
+	c.queue(WSResponse{
+		Type: "sync_complete",
+		Data: map[string]interface{}{
+			"lastSeq": result.LastSeq,
+			"hasMore": result.HasMore,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// queue waits for room in the send buffer instead of dropping the response,
+// so a large replay is not cut short. It gives up if the writer has stalled.
+func (c *Client) queue(response WSResponse) bool {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Failed to marshal response: %v", err)
+		return false
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	case <-time.After(writeWait):
+		log.Printf("Timed out queueing sync events: %s (%s)", c.userID, c.connID)
+		return false
+	}
+}
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNextSeqs_LocksCountersInOrder(t *testing.T) {
+	// Callers run it inside their own transaction
+	db := testutil.DryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var queries []string
+	var vars [][]interface{}
+	assert.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record", func(tx *gorm.DB) {
+		queries = append(queries, tx.Statement.SQL.String())
+		vars = append(vars, tx.Statement.Vars)
+	}))
+
+	_, err := nextSeqs(db, []string{"Ubob", "Ualice"})
+	assert.NoError(t, err)
+
+	// Counters are read under a row lock, always in the same order
+	assert.Len(t, queries, 1)
+	assert.Contains(t, queries[0], "ORDER BY user_id ASC FOR UPDATE")
+	assert.Equal(t, []interface{}{"Ualice", "Ubob"}, vars[0])
+}
+
+func TestEventRefs(t *testing.T) {
+	id, quoted := eventRefs([]byte(`{"uuid":"M1","content":"hi"}`))
+	assert.Equal(t, "M1", id)
+	assert.Empty(t, quoted)
+
+	// Events about other things, such as friend requests, aren't linked
+	for _, payload := range []string{`{"uuid":"A1","message":"hi"}`, `{"uuids":["M1"]}`, `"text"`} {
+		id, quoted = eventRefs([]byte(payload))
+		assert.Empty(t, id)
+		assert.Empty(t, quoted)
+	}
+}
+
+func TestForgetMessages_PinnedAndRepliedTo(t *testing.T) {
+	original := &model.Message{UUID: "M1", SendID: "Ualice", SendName: "Alice", ReceiveID: "Ggroup", Content: "secret plan"}
+	replyMsg := &model.Message{UUID: "M2", SendID: "Ubob", ReceiveID: "Ggroup", Content: "sounds good", ReplyToID: "M1"}
+
+	// Events as the hub and pin service store them
+	messageEvt, _ := json.Marshal(messageEvent(messagePayload(original, nil, nil), "Sbob").Data)
+	replyEvt, _ := json.Marshal(messageEvent(messagePayload(replyMsg, reply.NewQuote(original), nil), "Sbob").Data)
+	pinEvt, _ := json.Marshal(map[string]interface{}{
+		"messageId": "M1",
+		"pinnedBy":  "Ubob",
+		"pin":       map[string]interface{}{"messageId": "M1", "message": reply.NewQuote(original)},
+	})
+
+	// Recalling M1 deletes the events about it...
+	id, _ := eventRefs(messageEvt)
+	assert.Equal(t, "M1", id)
+	id, _ = eventRefs(pinEvt)
+	assert.Equal(t, "M1", id)
+
+	// ...and strips its text from the reply quoting it
+	id, quoted := eventRefs(replyEvt)
+	assert.Equal(t, "M2", id)
+	assert.Equal(t, "M1", quoted)
+
+	redacted := withoutQuote(string(replyEvt))
+	assert.NotContains(t, redacted, "secret plan")
+	assert.Contains(t, redacted, `"replyToId":"M1"`)
+	assert.Contains(t, redacted, "sounds good")
+	assert.Equal(t, "{}", withoutQuote("not json"))
+}
+
+func TestForgetMessages(t *testing.T) {
+	db := testutil.DryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var statements []string
+	record := func(tx *gorm.DB) { statements = append(statements, tx.Statement.SQL.String()) }
+	assert.NoError(t, db.Callback().Delete().After("gorm:delete").Register("test:record", record))
+	assert.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record", record))
+
+	assert.NoError(t, ForgetMessages(db, []string{"M1", "M2"}))
+	assert.Len(t, statements, 2)
+	assert.Contains(t, statements[0], `DELETE FROM "user_events" WHERE message_id IN ($1,$2)`)
+	assert.Contains(t, statements[1], `SELECT "id","payload" FROM "user_events" WHERE quoted_id IN ($1,$2)`)
+}
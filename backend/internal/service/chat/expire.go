@@ -0,0 +1,258 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+const (
+	// How often expired messages are looked for
+	expireSweepPeriod = 30 * time.Second
+
+	// Most messages deleted in one batch
+	expireBatchSize = 500
+
+	// Only one node sweeps at a time
+	expireLockKey = "chat:expire:lock"
+	expireLockTTL = 5 * time.Minute
+)
+
+// expiredConversation collects the messages swept from one conversation
+type expiredConversation struct {
+	sendID    string
+	receiveID string
+	uuids     []string
+}
+
+// expiredBatch is one batch of deleted messages, grouped by conversation
+type expiredBatch struct {
+	count         int
+	conversations []*expiredConversation
+}
+
+// sweepExpired deletes messages whose retention period has ended, tells the
+// conversations they came from and refreshes their session previews. Every
+// node's hub calls it; a Redis lock lets one of them do the work.
+func (h *Hub) sweepExpired(token string) {
+	locked, err := redis.SetNX(expireLockKey, token, expireLockTTL)
+	if err != nil {
+		log.Printf("Failed to acquire expiry lock: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer func() {
+		if err := redis.DeleteIfValue(expireLockKey, token); err != nil {
+			log.Printf("Failed to release expiry lock: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for {
+		swept, err := deleteExpired(now)
+		if err != nil {
+			log.Printf("Failed to delete expired messages: %v", err)
+			return
+		}
+		for _, c := range swept.conversations {
+			h.notifyExpired(c)
+		}
+		if swept.count < expireBatchSize {
+			return
+		}
+	}
+}
+
+// deleteExpired removes one batch of messages that expired before now together
+// with their stored events, reactions, pins and threads, including the
+// replies in those threads
+func deleteExpired(now time.Time) (*expiredBatch, error) {
+	var expired []model.Message
+	if err := database.DB.Select("id", "uuid", "send_id", "receive_id", "thread_id").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Order("id ASC").
+		Limit(expireBatchSize).
+		Find(&expired).Error; err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return &expiredBatch{}, nil
+	}
+	count := len(expired)
+
+	// Replies go with their thread's root, whatever their own expiry
+	replies, err := orphanedReplies(expired)
+	if err != nil {
+		return nil, err
+	}
+	expired = append(expired, replies...)
+
+	ids := make([]int64, len(expired))
+	uuids := make([]string, len(expired))
+	threadReplies := make(map[string]int)
+	for i, m := range expired {
+		ids[i], uuids[i] = m.ID, m.UUID
+		if m.ThreadID != "" {
+			threadReplies[m.ThreadID]++
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Stored events carry the content too; sync must not replay it
+		if err := ForgetMessages(tx, uuids); err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN ?", uuids).Delete(&model.Reaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN ?", uuids).Delete(&model.Pin{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("root_id IN ?", uuids).Delete(&model.ThreadFollower{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("root_id IN ?", uuids).Delete(&model.Thread{}).Error; err != nil {
+			return err
+		}
+		for rootID, n := range threadReplies {
+			if err := tx.Model(&model.Thread{}).Where("root_id = ?", rootID).
+				Update("reply_count", gorm.Expr("CASE WHEN reply_count > ? THEN reply_count - ? ELSE 0 END", n, n)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.Message{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &expiredBatch{count: count, conversations: groupByConversation(expired)}, nil
+}
+
+// orphanedReplies returns the thread replies under the timeline messages
+// being deleted that aren't among them already
+func orphanedReplies(expired []model.Message) ([]model.Message, error) {
+	roots := threadRoots(expired)
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	deleting := make([]string, len(expired))
+	for i, m := range expired {
+		deleting[i] = m.UUID
+	}
+
+	var replies []model.Message
+	if err := database.DB.Select("id", "uuid", "send_id", "receive_id", "thread_id").
+		Where("thread_id IN ? AND uuid NOT IN ?", roots, deleting).
+		Find(&replies).Error; err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// threadRoots returns the UUIDs of the timeline messages among messages, the
+// ones that may have a thread under them
+func threadRoots(messages []model.Message) []string {
+	var roots []string
+	for _, m := range messages {
+		if m.ThreadID == "" {
+			roots = append(roots, m.UUID)
+		}
+	}
+	return roots
+}
+
+// groupByConversation buckets messages by the conversation they belong to,
+// treating both directions of a direct chat as one conversation
+func groupByConversation(messages []model.Message) []*expiredConversation {
+	byKey := make(map[string]*expiredConversation)
+	var result []*expiredConversation
+	for _, m := range messages {
+		key := m.ReceiveID
+		if !session.IsGroupID(m.ReceiveID) {
+			pair := []string{m.SendID, m.ReceiveID}
+			sort.Strings(pair)
+			key = pair[0] + ":" + pair[1]
+		}
+
+		c, ok := byKey[key]
+		if !ok {
+			c = &expiredConversation{sendID: m.SendID, receiveID: m.ReceiveID}
+			byKey[key] = c
+			result = append(result, c)
+		}
+		c.uuids = append(c.uuids, m.UUID)
+	}
+	return result
+}
+
+// notifyExpired replaces the conversation's session previews with its newest
+// remaining message, so the list never shows expired content, and tells its
+// participants which messages are gone
+func (h *Hub) notifyExpired(c *expiredConversation) {
+	data := map[string]interface{}{
+		"uuids":     c.uuids,
+		"sendId":    c.sendID,
+		"receiveId": c.receiveID,
+	}
+
+	preview, err := latestPreview(c.sendID, c.receiveID)
+	if err != nil {
+		log.Printf("Failed to get latest message: %v", err)
+	} else if err := session.SetConversationPreview(c.sendID, c.receiveID, preview); err != nil {
+		log.Printf("Failed to refresh session previews: %v", err)
+	} else {
+		data["lastMessage"] = preview
+	}
+
+	h.SendToConversation(c.sendID, c.receiveID, WSResponse{
+		Type:      "message_expired",
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// NotifyMessageTTL tells a conversation's participants that its retention
+// period changed
+func (h *Hub) NotifyMessageTTL(userID, receiveID string, seconds int) {
+	h.SendToConversation(userID, receiveID, WSResponse{
+		Type: "message_ttl_changed",
+		Data: map[string]interface{}{
+			"sendId":     userID,
+			"receiveId":  receiveID,
+			"ttlSeconds": seconds,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// latestPreview returns the session-list text for a conversation's newest
+// unexpired timeline message, or "" when none is left
+func latestPreview(sendID, receiveID string) (string, error) {
+	var latest model.Message
+	if err := database.DB.Scopes(conversation.Timeline(sendID, receiveID, time.Now())).
+		Order("created_at DESC, id DESC").
+		First(&latest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	preview := session.Preview(&latest)
+	if session.IsGroupID(receiveID) {
+		preview = session.GroupPreview(latest.SendName, preview)
+	}
+	return preview, nil
+}
@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupByConversation(t *testing.T) {
+	conversations := groupByConversation([]model.Message{
+		{UUID: "M1", SendID: "Ualice", ReceiveID: "Ubob"},
+		{UUID: "M2", SendID: "Ucarol", ReceiveID: "Ggroup"},
+		{UUID: "M3", SendID: "Ubob", ReceiveID: "Ualice"},
+		{UUID: "M4", SendID: "Ualice", ReceiveID: "Ggroup"},
+	})
+
+	// Both directions of a direct chat are one conversation
+	assert.Len(t, conversations, 2)
+	assert.Equal(t, []string{"M1", "M3"}, conversations[0].uuids)
+	assert.Equal(t, "Ubob", conversations[0].receiveID)
+	assert.Equal(t, []string{"M2", "M4"}, conversations[1].uuids)
+	assert.Equal(t, "Ggroup", conversations[1].receiveID)
+}
+
+func TestThreadRoots(t *testing.T) {
+	roots := threadRoots([]model.Message{
+		{UUID: "M1"},
+		{UUID: "M2", ThreadID: "M9"},
+		{UUID: "M3"},
+	})
+
+	// Replies can't have threads of their own
+	assert.Equal(t, []string{"M1", "M3"}, roots)
+	assert.Empty(t, threadRoots([]model.Message{{UUID: "M2", ThreadID: "M9"}}))
+}
+
+func TestMessagePayload_ExpiresAt(t *testing.T) {
+	expiresAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := &model.Message{UUID: "M1", ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true}}
+
+	assert.Equal(t, "2024-05-01 12:00:00", messagePayload(m, nil, nil)["expiresAt"])
+	assert.NotContains(t, messagePayload(&model.Message{UUID: "M2"}, nil, nil), "expiresAt")
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"log"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+)
+
+// forwardSource is the original message and author a forwarded copy credits
+type forwardSource struct {
+	messageID string
+	userID    string
+	userName  string
+}
+
+// originOf returns the message a forward of m credits; forwarding a forward
+// keeps crediting the original
+func originOf(m *model.Message) *forwardSource {
+	if m.ForwardedFromID != "" {
+		return &forwardSource{m.ForwardedFromID, m.ForwardedFromUser, m.ForwardedFromName}
+	}
+	return &forwardSource{m.UUID, m.SendID, m.SendName}
+}
+
+// Forward sends a copy of source from senderID to receiveID, keeping its text
+// and attachment and crediting the original author. It goes through the same
+// checks, session updates and delivery as a message sent over WebSocket.
+func (h *Hub) Forward(senderID, senderName, senderAvatar string, source *model.Message, receiveID string) (*model.Message, error) {
+	msg := &WSMessage{
+		Type:       int(source.Type),
+		Content:    source.Content,
+		URL:        source.URL,
+		SendID:     senderID,
+		SendName:   senderName,
+		SendAvatar: senderAvatar,
+		ReceiveID:  receiveID,
+		forwarded:  originOf(source),
+	}
+
+	// Callers check the target up front, so the sender's session can be set up
+	// before the checks run again
+	msg.SessionID = SenderSessionID(senderID, receiveID)
+
+	return h.Deliver(msg)
+}
+
+// SenderSessionID returns the sender's own session for a direct chat, creating
+// it if this is the first message they send there. Group sessions are handled
+// when the message is routed.
+func SenderSessionID(senderID, receiveID string) string {
+	if session.IsGroupID(receiveID) {
+		return ""
+	}
+
+	var receiver model.User
+	if err := database.DB.Where("uuid = ?", receiveID).Select("uuid", "nickname", "avatar").
+		First(&receiver).Error; err != nil {
+		log.Printf("Failed to get message receiver: %v", err)
+		return ""
+	}
+	sess, err := session.GetOrCreate(senderID, receiveID, receiver.Nickname, receiver.Avatar)
+	if err != nil {
+		log.Printf("Failed to get/create sender session: %v", err)
+		return ""
+	}
+	return sess.UUID
+}
@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginOf(t *testing.T) {
+	original := &model.Message{UUID: "M1", SendID: "Ualice", SendName: "Alice"}
+	assert.Equal(t, &forwardSource{"M1", "Ualice", "Alice"}, originOf(original))
+
+	// A forward of a forward still credits the first author
+	forward := &model.Message{UUID: "M2", SendID: "Ubob", SendName: "Bob",
+		ForwardedFromID: "M1", ForwardedFromUser: "Ualice", ForwardedFromName: "Alice"}
+	assert.Equal(t, &forwardSource{"M1", "Ualice", "Alice"}, originOf(forward))
+}
+
+func TestMessagePayload_Forwarded(t *testing.T) {
+	m := &model.Message{UUID: "M2", ForwardedFromID: "M1", ForwardedFromUser: "Ualice", ForwardedFromName: "Alice"}
+
+	payload := messagePayload(m, nil, nil)
+
+	assert.Equal(t, "M1", payload["forwardedFromId"])
+	assert.Equal(t, "Alice", payload["forwardedFromName"])
+	assert.NotContains(t, messagePayload(&model.Message{UUID: "M3"}, nil, nil), "forwardedFromId")
+}
@@ -3,20 +3,29 @@ package chat
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/database"
 	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/linkpreview"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/media"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
 	"github.com/google/uuid"
 )
 
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
-	// Registered clients, keyed by user UUID
-	clients map[string]*Client
+	// Registered clients, keyed by user UUID then connection ID
+	clients map[string]map[string]*Client
 
 	// Register requests from clients
 	register chan *Client
@@ -27,8 +36,17 @@ type Hub struct {
 	// Inbound messages from clients
 	broadcast chan *WSMessage
 
+	// Delivery receipts waiting to be stored
+	receipts chan receipt
+
+	// Messages waiting for a link preview
+	previews chan previewJob
+
 	// Mutex for thread-safe access to clients map
 	mu sync.RWMutex
+
+	// Identifies this process among the nodes sharing Redis
+	nodeID string
 }
 
 var (
@@ -40,10 +58,13 @@ var (
 func GetHub() *Hub {
 	hubOnce.Do(func() {
 		hubInstance = &Hub{
-			clients:    make(map[string]*Client),
+			clients:    make(map[string]map[string]*Client),
 			register:   make(chan *Client, 256),
 			unregister: make(chan *Client, 256),
 			broadcast:  make(chan *WSMessage, 256),
+			receipts:   make(chan receipt, receiptQueueSize),
+			previews:   make(chan previewJob, previewQueueSize),
+			nodeID:     "N" + uuid.New().String()[:11],
 		}
 	})
 	return hubInstance
@@ -51,29 +72,52 @@ func GetHub() *Hub {
 
 // Run starts the hub's main event loop
 func (h *Hub) Run() {
+	go h.subscribe()
+	go h.storeReceipts()
+	for i := 0; i < maxPreviewFetches; i++ {
+		go h.fetchPreviews()
+	}
+
+	ticker := time.NewTicker(presenceRefreshPeriod)
+	defer ticker.Stop()
+
+	pruneTicker := time.NewTicker(eventPrunePeriod)
+	defer pruneTicker.Stop()
+
+	expireTicker := time.NewTicker(expireSweepPeriod)
+	defer expireTicker.Stop()
+	expireToken := uuid.New().String()
+
 	for {
 		select {
 		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client.userID] = client
-			h.mu.Unlock()
-			log.Printf("Client connected: %s (%s)", client.nickname, client.userID)
+			h.addClient(client)
+			h.markOnline(client.userID)
+			log.Printf("Client connected: %s (%s) device %s", client.nickname, client.userID, client.deviceID)
 
 			// Send welcome message
 			h.sendToClient(client, WSResponse{
-				Type:      "system",
-				Data:      map[string]string{"message": "Connected to chat server"},
+				Type: "system",
+				Data: map[string]string{
+					"message":      "Connected to chat server",
+					"connectionId": client.connID,
+					"deviceId":     client.deviceID,
+				},
 				Timestamp: time.Now().Unix(),
 			})
 
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client.userID]; ok {
-				delete(h.clients, client.userID)
-				close(client.send)
+			removed, lastConn := h.removeClient(client)
+			if !removed {
+				continue
+			}
+			log.Printf("Client disconnected: %s (%s) device %s", client.nickname, client.userID, client.deviceID)
+
+			// Other devices are still connected, so the user stays online
+			if !lastConn {
+				continue
 			}
-			h.mu.Unlock()
-			log.Printf("Client disconnected: %s (%s)", client.nickname, client.userID)
+			h.markOffline(client.userID)
 
 			// Update last offline time
 			database.DB.Model(&model.User{}).
@@ -82,14 +126,307 @@ func (h *Hub) Run() {
 
 		case msg := <-h.broadcast:
 			h.handleMessage(msg)
+
+		case <-ticker.C:
+			h.refreshPresence()
+
+		case <-pruneTicker.C:
+			go pruneEvents()
+
+		case <-expireTicker.C:
+			go h.sweepExpired(expireToken)
 		}
 	}
 }
 
+// addClient registers a connection alongside any the user already has
+func (h *Hub) addClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[client.userID]
+	if !ok {
+		conns = make(map[string]*Client)
+		h.clients[client.userID] = conns
+	}
+	conns[client.connID] = client
+}
+
+// removeClient unregisters exactly this connection. It reports whether the
+// connection was registered and whether it was the user's last one on this node.
+func (h *Hub) removeClient(client *Client) (removed, lastConn bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[client.userID]
+	if !ok || conns[client.connID] != client {
+		return false, false
+	}
+
+	delete(conns, client.connID)
+	close(client.send)
+	if len(conns) == 0 {
+		delete(h.clients, client.userID)
+		return true, true
+	}
+	return true, false
+}
+
+// SendError rejects a message with a machine-readable code for clients
+type SendError struct {
+	Code   string
+	Reason string
+	Err    error // Underlying cause, if any
+}
+
+func (e *SendError) Error() string {
+	return e.Reason
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
 // handleMessage processes an incoming message and routes it to recipients
 func (h *Hub) handleMessage(msg *WSMessage) {
-	// Save message to database
-	dbMsg := model.Message{
+	quote, err := prepareMessage(msg)
+	if err != nil {
+		var sendErr *SendError
+		errors.As(err, &sendErr)
+		h.nack(msg, sendErr.Code, sendErr.Reason)
+		return
+	}
+
+	dbMsg, duplicate, err := saveMessage(msg)
+	if err != nil {
+		log.Printf("Failed to save message: %v", err)
+		h.nack(msg, "save_failed", "Failed to save message")
+		return
+	}
+	h.ack(msg, dbMsg)
+
+	// A retried send was already delivered the first time
+	if duplicate {
+		return
+	}
+	h.QueueLinkPreview(dbMsg)
+	h.route(msg, dbMsg, quote)
+}
+
+// Deliver sends a message composed on the server rather than received over a
+// connection. It runs the same checks, storage and routing as handleMessage
+// and returns the stored message; rejections are *SendError.
+func (h *Hub) Deliver(msg *WSMessage) (*model.Message, error) {
+	quote, err := prepareMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	dbMsg, duplicate, err := saveMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
+	}
+	if !duplicate {
+		h.QueueLinkPreview(dbMsg)
+		h.route(msg, dbMsg, quote)
+	}
+	return dbMsg, nil
+}
+
+// prepareMessage checks that a message may be sent and fills in the details the
+// server decides: the replied-to quote, mentions and attachment metadata.
+// Every error it returns is a *SendError.
+func prepareMessage(msg *WSMessage) (*reply.Quote, error) {
+	if len(msg.ClientMsgID) > maxClientMsgIDLen {
+		return nil, &SendError{"invalid_request", "clientMsgId is too long", nil}
+	}
+
+	if err := permission.CanSend(msg.SendID, msg.ReceiveID, msg.SessionID); err != nil {
+		if permErr, ok := permission.AsError(err); ok {
+			return nil, &SendError{permErr.Code, permErr.Message, err}
+		}
+		log.Printf("Failed to check send permission: %v", err)
+		return nil, &SendError{"internal_error", "Failed to check permissions", err}
+	}
+
+	var quote *reply.Quote
+	if msg.ReplyToID != "" {
+		target, err := reply.Validate(msg.SendID, msg.ReceiveID, msg.ReplyToID)
+		if err != nil {
+			if errors.Is(err, reply.ErrReplyNotFound) || errors.Is(err, reply.ErrReplyOtherChat) {
+				return nil, &SendError{"invalid_reply", err.Error(), err}
+			}
+			log.Printf("Failed to load replied-to message: %v", err)
+			return nil, &SendError{"internal_error", "Failed to load replied-to message", err}
+		}
+		quote = reply.NewQuote(target)
+	}
+
+	// Forwarded text keeps its original wording without notifying anyone
+	if msg.forwarded == nil {
+		mentions, err := mention.Resolve(msg.SendID, msg.ReceiveID, msg.Content, msg.Mentions)
+		if err != nil {
+			if isMentionError(err) {
+				return nil, &SendError{"invalid_mention", err.Error(), err}
+			}
+			log.Printf("Failed to resolve mentions: %v", err)
+			return nil, &SendError{"internal_error", "Failed to resolve mentions", err}
+		}
+		msg.mentions = mentions
+	}
+
+	// File details come from the stored upload, not the client
+	if msg.URL != "" {
+		file, err := upload.ResolveAttachment(msg.SendID, msg.URL, int8(msg.Type))
+		if err != nil {
+			if errors.Is(err, upload.ErrInvalidAttachment) {
+				return nil, &SendError{"invalid_attachment", err.Error(), err}
+			}
+			log.Printf("Failed to resolve attachment: %v", err)
+			return nil, &SendError{"internal_error", "Failed to resolve attachment", err}
+		}
+		msg.URL, msg.FileType, msg.FileName, msg.FileSize = upload.URL(file.UUID), file.MimeType, file.FileName, file.Size
+		msg.durationMs, msg.waveform = file.DurationMs, file.Waveform
+	}
+
+	return quote, nil
+}
+
+// route updates every participant's session for a newly saved message and
+// delivers it to them
+func (h *Hub) route(msg *WSMessage, dbMsg *model.Message, quote *reply.Quote) {
+	// The receive ID, not the client's flag, decides whether this is a group message
+	msg.IsGroup = session.IsGroupID(msg.ReceiveID)
+
+	// Update session last message
+	displayContent := session.Preview(dbMsg)
+
+	if msg.IsGroup {
+		// Group message: every member gets it with their own session ID
+		preview := session.GroupPreview(msg.SendName, displayContent)
+		sessionIDs, err := session.UpdateGroupSessions(msg.ReceiveID, msg.SendID, preview)
+		if err != nil {
+			log.Printf("Failed to update group sessions: %v", err)
+			return
+		}
+
+		payload := messagePayload(dbMsg, quote, upload.MediaFor(dbMsg.URL))
+		responses := make(map[string]WSResponse, len(sessionIDs))
+		for memberID, sessionID := range sessionIDs {
+			responses[memberID] = messageEvent(payload, sessionID)
+		}
+		h.sendEach(responses)
+		h.notifyMentions(dbMsg, sessionIDs)
+		return
+	}
+
+	// Update sender's session
+	if msg.SessionID != "" {
+		session.UpdateLastMessage(msg.SessionID, displayContent)
+	}
+
+	// Get or create receiver's session
+	var receiverSessionID string
+	receiverSession, err := session.GetOrCreate(msg.ReceiveID, msg.SendID, msg.SendName, msg.SendAvatar)
+	if err != nil {
+		log.Printf("Failed to get/create receiver session: %v", err)
+	} else {
+		receiverSessionID = receiverSession.UUID
+		// Update receiver's session last message
+		session.UpdateLastMessage(receiverSessionID, displayContent)
+		// Increment unread count for receiver's session
+		if err := session.IncrementUnread(receiverSessionID); err != nil {
+			log.Printf("Failed to increment unread count: %v", err)
+		}
+	}
+
+	// Send to sender and receiver, each with their own session ID
+	payload := messagePayload(dbMsg, quote, upload.MediaFor(dbMsg.URL))
+	h.SendToUser(msg.SendID, messageEvent(payload, msg.SessionID))
+	h.SendToUser(msg.ReceiveID, messageEvent(payload, receiverSessionID))
+}
+
+// messagePayload builds the "message" event data shared by every recipient
+func messagePayload(m *model.Message, quote *reply.Quote, info *upload.MediaInfo) map[string]interface{} {
+	clientMsgID := ""
+	if m.ClientMsgID != nil {
+		clientMsgID = *m.ClientMsgID
+	}
+
+	payload := map[string]interface{}{
+		"uuid":        m.UUID,
+		"clientMsgId": clientMsgID,
+		"type":        m.Type,
+		"content":     m.Content,
+		"url":         m.URL,
+		"sendId":      m.SendID,
+		"sendName":    m.SendName,
+		"sendAvatar":  m.SendAvatar,
+		"receiveId":   m.ReceiveID,
+		"fileType":    m.FileType,
+		"fileName":    m.FileName,
+		"fileSize":    m.FileSize,
+		"avData":      m.AVData,
+		"createdAt":   m.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if quote != nil {
+		payload["replyToId"] = quote.UUID
+		payload["replyTo"] = quote
+	}
+	if info != nil {
+		payload["media"] = info
+	}
+	if m.DurationMs > 0 {
+		payload["durationMs"] = m.DurationMs
+		payload["waveform"] = media.DecodeWaveform(m.Waveform)
+	}
+	if m.ThreadID != "" {
+		payload["threadId"] = m.ThreadID
+	}
+	if m.ExpiresAt.Valid {
+		payload["expiresAt"] = m.ExpiresAt.Time.Format("2006-01-02 15:04:05")
+	}
+	if m.ForwardedFromID != "" {
+		payload["forwardedFromId"] = m.ForwardedFromID
+		payload["forwardedFromUser"] = m.ForwardedFromUser
+		payload["forwardedFromName"] = m.ForwardedFromName
+	}
+	if ids := mention.Decode(m.Mentions); len(ids) > 0 || m.MentionAll {
+		payload["mentions"] = ids
+		payload["mentionAll"] = m.MentionAll
+	}
+	if preview := linkpreview.Decode(m.LinkPreview); preview != nil {
+		payload["linkPreview"] = preview
+	}
+	return payload
+}
+
+// messageEvent addresses a message payload to one recipient's session
+func messageEvent(payload map[string]interface{}, sessionID string) WSResponse {
+	data := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		data[k] = v
+	}
+	data["sessionId"] = sessionID
+
+	return WSResponse{
+		Type:      "message",
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// saveMessage stores a message unless the sender already sent one with the same
+// clientMsgId, in which case the original is returned and duplicate is true
+func saveMessage(msg *WSMessage) (dbMsg *model.Message, duplicate bool, err error) {
+	if msg.ClientMsgID != "" {
+		if existing := findByClientMsgID(msg.SendID, msg.ClientMsgID); existing != nil {
+			return existing, true, nil
+		}
+	}
+
+	now := time.Now()
+	dbMsg = &model.Message{
 		UUID:       "M" + uuid.New().String()[:11],
 		SessionID:  msg.SessionID,
 		Type:       int8(msg.Type),
@@ -104,99 +441,89 @@ func (h *Hub) handleMessage(msg *WSMessage) {
 		FileSize:   msg.FileSize,
 		Status:     model.MessageStatusSent,
 		AVData:     msg.AVData,
-		SentAt:     sql.NullTime{Time: time.Now(), Valid: true},
+		ReplyToID:  msg.ReplyToID,
+		ThreadID:   msg.threadID,
+		DurationMs: msg.durationMs,
+		Waveform:   msg.waveform,
+		SentAt:     sql.NullTime{Time: now, Valid: true},
+		ExpiresAt:  session.ExpiresAt(msg.SendID, msg.ReceiveID, now),
 	}
-
-	if err := database.DB.Create(&dbMsg).Error; err != nil {
-		log.Printf("Failed to save message: %v", err)
+	if msg.ClientMsgID != "" {
+		dbMsg.ClientMsgID = &msg.ClientMsgID
 	}
-
-	// Update session last message
-	displayContent := msg.Content
-	switch msg.Type {
-	case MessageTypeVoice:
-		displayContent = "[Voice message]"
-	case MessageTypeFile:
-		displayContent = "[File: " + msg.FileName + "]"
-	case MessageTypeImage:
-		displayContent = "[Image]"
-	case MessageTypeVideoCall:
-		displayContent = "[Video call]"
+	if msg.mentions != nil {
+		msg.mentions.Apply(dbMsg)
 	}
-
-	// Update sender's session
-	if msg.SessionID != "" {
-		session.UpdateLastMessage(msg.SessionID, displayContent)
+	if msg.forwarded != nil {
+		dbMsg.ForwardedFromID = msg.forwarded.messageID
+		dbMsg.ForwardedFromUser = msg.forwarded.userID
+		dbMsg.ForwardedFromName = msg.forwarded.userName
 	}
 
-	// Get or create receiver's session (for direct messages)
-	var receiverSessionID string
-	if !msg.IsGroup {
-		receiverSession, err := session.GetOrCreate(msg.ReceiveID, msg.SendID, msg.SendName, msg.SendAvatar)
-		if err != nil {
-			log.Printf("Failed to get/create receiver session: %v", err)
-		} else {
-			receiverSessionID = receiverSession.UUID
-			// Update receiver's session last message
-			session.UpdateLastMessage(receiverSessionID, displayContent)
-			// Increment unread count for receiver's session
-			if err := session.IncrementUnread(receiverSessionID); err != nil {
-				log.Printf("Failed to increment unread count: %v", err)
+	if err := database.DB.Create(dbMsg).Error; err != nil {
+		// Lost a race with a concurrent retry of the same message
+		if msg.ClientMsgID != "" {
+			if existing := findByClientMsgID(msg.SendID, msg.ClientMsgID); existing != nil {
+				return existing, true, nil
 			}
 		}
+		return nil, false, err
+	}
+	return dbMsg, false, nil
+}
+
+// findByClientMsgID returns the sender's message with the given client ID, if any
+func findByClientMsgID(sendID, clientMsgID string) *model.Message {
+	var existing model.Message
+	if err := database.DB.Where("send_id = ? AND client_msg_id = ?", sendID, clientMsgID).
+		First(&existing).Error; err != nil {
+		return nil
 	}
+	return &existing
+}
+
+// ack confirms to the sending connection that a message was stored
+func (h *Hub) ack(msg *WSMessage, dbMsg *model.Message) {
+	h.reply(msg, WSResponse{
+		Type: "ack",
+		Data: map[string]interface{}{
+			"clientMsgId": msg.ClientMsgID,
+			"uuid":        dbMsg.UUID,
+			"sessionId":   dbMsg.SessionID,
+			"createdAt":   dbMsg.CreatedAt.Format("2006-01-02 15:04:05"),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
 
-	// Prepare response for sender (with sender's session ID)
-	senderResponse := WSResponse{
-		Type: "message",
+// nack tells the sending connection that a message was rejected, with a
+// machine-readable code and a human-readable reason
+func (h *Hub) nack(msg *WSMessage, code, reason string) {
+	h.reply(msg, WSResponse{
+		Type: "nack",
 		Data: map[string]interface{}{
-			"uuid":       dbMsg.UUID,
-			"type":       msg.Type,
-			"content":    msg.Content,
-			"url":        msg.URL,
-			"sendId":     msg.SendID,
-			"sendName":   msg.SendName,
-			"sendAvatar": msg.SendAvatar,
-			"receiveId":  msg.ReceiveID,
-			"sessionId":  msg.SessionID,
-			"fileType":   msg.FileType,
-			"fileName":   msg.FileName,
-			"fileSize":   msg.FileSize,
-			"avData":     msg.AVData,
-			"createdAt":  dbMsg.CreatedAt.Format("2006-01-02 15:04:05"),
+			"clientMsgId": msg.ClientMsgID,
+			"code":        code,
+			"reason":      reason,
 		},
 		Timestamp: time.Now().Unix(),
+	})
+}
+
+// reply answers the connection a message came from, or all of the sender's
+// devices when the message did not arrive over a WebSocket
+func (h *Hub) reply(msg *WSMessage, response WSResponse) {
+	if msg.client == nil {
+		h.SendToUser(msg.SendID, response)
+		return
 	}
 
-	if msg.IsGroup {
-		// Group message: send to all group members
-		h.broadcastToGroup(msg.ReceiveID, senderResponse)
-	} else {
-		// Direct message: send to sender with their session ID
-		h.SendToUser(msg.SendID, senderResponse)
-
-		// Send to receiver with their session ID
-		receiverResponse := WSResponse{
-			Type: "message",
-			Data: map[string]interface{}{
-				"uuid":       dbMsg.UUID,
-				"type":       msg.Type,
-				"content":    msg.Content,
-				"url":        msg.URL,
-				"sendId":     msg.SendID,
-				"sendName":   msg.SendName,
-				"sendAvatar": msg.SendAvatar,
-				"receiveId":  msg.ReceiveID,
-				"sessionId":  receiverSessionID,
-				"fileType":   msg.FileType,
-				"fileName":   msg.FileName,
-				"fileSize":   msg.FileSize,
-				"avData":     msg.AVData,
-				"createdAt":  dbMsg.CreatedAt.Format("2006-01-02 15:04:05"),
-			},
-			Timestamp: time.Now().Unix(),
-		}
-		h.SendToUser(msg.ReceiveID, receiverResponse)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// The connection may have closed while the message was queued
+	if h.clients[msg.SendID][msg.client.connID] == msg.client {
+		h.sendToClient(msg.client, response)
 	}
 }
 
@@ -207,67 +534,152 @@ func (h *Hub) sendToClient(client *Client, response WSResponse) {
 		log.Printf("Failed to marshal response: %v", err)
 		return
 	}
+	h.sendRaw(client, data)
+}
 
+// sendRaw queues an encoded response on a client's send buffer, reporting whether it fit
+func (h *Hub) sendRaw(client *Client, data []byte) bool {
 	select {
 	case client.send <- data:
+		return true
 	default:
 		// Client buffer is full, skip message
-		log.Printf("Client buffer full: %s", client.userID)
+		log.Printf("Client buffer full: %s (%s)", client.userID, client.connID)
+		return false
 	}
 }
 
-// SendToUser sends a response to a user by their UUID
-func (h *Hub) SendToUser(userID string, response WSResponse) {
+// deliverLocal sends an encoded response to every device a user has connected to this node,
+// reporting whether any device received it
+func (h *Hub) deliverLocal(userID string, data []byte) bool {
 	h.mu.RLock()
-	client, ok := h.clients[userID]
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
+
+	delivered := false
+	for _, client := range h.clients[userID] {
+		if h.sendRaw(client, data) {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+// SendToUser sends a response to a user by their UUID, on whichever node they are connected.
+// Unless the event is ephemeral it is also stored so an offline user receives it on sync.
+func (h *Hub) SendToUser(userID string, response WSResponse) {
+	h.SendToUsers([]string{userID}, response)
+}
+
+// SendToUsers sends a response to several users, see SendToUser
+func (h *Hub) SendToUsers(userIDs []string, response WSResponse) {
+	responses := make(map[string]WSResponse, len(userIDs))
+	for _, userID := range userIDs {
+		responses[userID] = response
+	}
+	h.sendEach(responses)
+}
+
+// sendEach delivers a possibly different response to each user, keyed by user ID.
+// Durable responses are stored first so each carries its recipient's sequence number.
+func (h *Hub) sendEach(responses map[string]WSResponse) {
+	seqs := appendEvents(responses)
+
+	payloads := make(map[string][]byte, len(responses))
+	for userID, response := range responses {
+		response.Seq = seqs[userID]
+		data, err := json.Marshal(response)
+		if err != nil {
+			log.Printf("Failed to marshal response: %v", err)
+			continue
+		}
+		payloads[userID] = data
+	}
 
-	if ok {
-		h.sendToClient(client, response)
+	var delivered []string
+	for userID, data := range payloads {
+		if h.deliverLocal(userID, data) {
+			delivered = append(delivered, userID)
+		}
 	}
+	h.recordDeliveries(responses, delivered)
+	h.relay(payloads)
 }
 
 // broadcastToGroup sends a message to all members of a group
 func (h *Hub) broadcastToGroup(groupUUID string, response WSResponse) {
-	// Get group members
-	var group model.Group
-	if err := database.DB.Where("uuid = ?", groupUUID).First(&group).Error; err != nil {
-		log.Printf("Failed to get group: %v", err)
+	members, err := groupMembers(groupUUID)
+	if err != nil {
+		log.Printf("Failed to get group members: %v", err)
 		return
 	}
 
+	// Send to all members across the cluster
+	h.SendToUsers(members, response)
+}
+
+// groupMembers returns the user IDs of a group's members
+func groupMembers(groupUUID string) ([]string, error) {
 	var members []string
-	if err := json.Unmarshal(group.Members, &members); err != nil {
-		log.Printf("Failed to parse group members: %v", err)
+	if err := database.DB.Model(&model.GroupMember{}).Where("group_id = ?", groupUUID).
+		Pluck("user_id", &members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SendToConversation sends a response to everyone in a conversation: both
+// users of a direct chat, or every member of a group
+func (h *Hub) SendToConversation(userID, receiveID string, response WSResponse) {
+	if session.IsGroupID(receiveID) {
+		h.broadcastToGroup(receiveID, response)
 		return
 	}
+	h.SendToUsers([]string{userID, receiveID}, response)
+}
 
-	// Send to all online members
+// localUsers returns the IDs of users connected to this node
+func (h *Hub) localUsers() []string {
 	h.mu.RLock()
-	for _, memberID := range members {
-		if client, ok := h.clients[memberID]; ok {
-			h.sendToClient(client, response)
-		}
+	defer h.mu.RUnlock()
+
+	users := make([]string, 0, len(h.clients))
+	for userID := range h.clients {
+		users = append(users, userID)
 	}
-	h.mu.RUnlock()
+	return users
 }
 
-// IsOnline checks if a user is currently connected
+// IsOnline checks if a user is currently connected to any node
 func (h *Hub) IsOnline(userID string) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, ok := h.clients[userID]
-	return ok
+	if !clusterEnabled() {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		_, ok := h.clients[userID]
+		return ok
+	}
+
+	score, ok, err := redis.GetSortedScore(onlineUsersKey, userID)
+	if err != nil {
+		log.Printf("Failed to check presence for %s: %v", userID, err)
+		return false
+	}
+	return ok && int64(score) >= time.Now().Add(-presenceTTL).Unix()
 }
 
-// GetOnlineUsers returns a list of online user IDs
+// GetOnlineUsers returns a list of user IDs online anywhere in the cluster
 func (h *Hub) GetOnlineUsers() []string {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if !clusterEnabled() {
+		return h.localUsers()
+	}
 
-	users := make([]string, 0, len(h.clients))
-	for userID := range h.clients {
-		users = append(users, userID)
+	cutoff := float64(time.Now().Add(-presenceTTL).Unix())
+	// Drop users whose node stopped refreshing them (e.g. it crashed)
+	redis.RemoveSortedBelowScore(onlineUsersKey, cutoff)
+
+	users, err := redis.GetSortedByMinScore(onlineUsersKey, cutoff)
+	if err != nil {
+		log.Printf("Failed to get online users: %v", err)
+		return h.localUsers()
 	}
 	return users
 }
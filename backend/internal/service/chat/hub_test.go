@@ -0,0 +1,231 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/linkpreview"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestHub creates a hub that is not connected to Redis or the database
+func newTestHub() *Hub {
+	return &Hub{
+		clients:    make(map[string]map[string]*Client),
+		register:   make(chan *Client, 1),
+		unregister: make(chan *Client, 1),
+		broadcast:  make(chan *WSMessage, 1),
+		receipts:   make(chan receipt, 8),
+		previews:   make(chan previewJob, 8),
+		nodeID:     "Ntest",
+	}
+}
+
+func newTestClient(hub *Hub, userID string) *Client {
+	return newTestDevice(hub, userID, "C"+userID)
+}
+
+func newTestDevice(hub *Hub, userID, connID string) *Client {
+	client := &Client{hub: hub, send: make(chan []byte, 8), userID: userID, connID: connID, deviceID: connID}
+	hub.addClient(client)
+	return client
+}
+
+func TestSendToUser_LocalDelivery(t *testing.T) {
+	hub := newTestHub()
+	alice := newTestClient(hub, "Ualice")
+	bob := newTestClient(hub, "Ubob")
+
+	hub.SendToUser("Ualice", WSResponse{Type: "message", Data: "hi", Timestamp: 1})
+
+	assert.Len(t, alice.send, 1)
+	assert.Len(t, bob.send, 0)
+
+	var resp WSResponse
+	assert.NoError(t, json.Unmarshal(<-alice.send, &resp))
+	assert.Equal(t, "message", resp.Type)
+	assert.Equal(t, "hi", resp.Data)
+}
+
+func TestSendToUser_UnknownUser(t *testing.T) {
+	hub := newTestHub()
+	alice := newTestClient(hub, "Ualice")
+
+	hub.SendToUser("Ucarol", WSResponse{Type: "message"})
+
+	assert.Len(t, alice.send, 0)
+}
+
+func TestSendToUser_AllDevices(t *testing.T) {
+	hub := newTestHub()
+	phone := newTestDevice(hub, "Ualice", "Cphone")
+	laptop := newTestDevice(hub, "Ualice", "Claptop")
+
+	hub.SendToUser("Ualice", WSResponse{Type: "message"})
+
+	assert.Len(t, phone.send, 1)
+	assert.Len(t, laptop.send, 1)
+}
+
+func TestRemoveClient_OnlyClosingConnection(t *testing.T) {
+	hub := newTestHub()
+	phone := newTestDevice(hub, "Ualice", "Cphone")
+	laptop := newTestDevice(hub, "Ualice", "Claptop")
+
+	removed, last := hub.removeClient(phone)
+	assert.True(t, removed)
+	assert.False(t, last)
+	assert.True(t, hub.IsOnline("Ualice"))
+
+	hub.SendToUser("Ualice", WSResponse{Type: "message"})
+	assert.Len(t, laptop.send, 1)
+
+	// A stale unregister for an already removed connection is ignored
+	removed, _ = hub.removeClient(phone)
+	assert.False(t, removed)
+
+	removed, last = hub.removeClient(laptop)
+	assert.True(t, removed)
+	assert.True(t, last)
+	assert.False(t, hub.IsOnline("Ualice"))
+}
+
+func TestOnlineStatus_WithoutCluster(t *testing.T) {
+	hub := newTestHub()
+	newTestClient(hub, "Ualice")
+
+	assert.True(t, hub.IsOnline("Ualice"))
+	assert.False(t, hub.IsOnline("Ubob"))
+	assert.Equal(t, []string{"Ualice"}, hub.GetOnlineUsers())
+}
+
+func TestNodeChannel(t *testing.T) {
+	assert.Equal(t, "chat:node:N1", nodeChannel("N1"))
+	assert.Equal(t, "chat:presence:U1", presenceKey("U1"))
+}
+
+func TestSendToUsers_EphemeralHasNoSeq(t *testing.T) {
+	hub := newTestHub()
+	alice := newTestClient(hub, "Ualice")
+	bob := newTestClient(hub, "Ubob")
+
+	hub.SendToUsers([]string{"Ualice", "Ubob"}, WSResponse{Type: "system", Data: "hello"})
+
+	for _, c := range []*Client{alice, bob} {
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(<-c.send, &resp))
+		assert.Equal(t, "system", resp["type"])
+		assert.NotContains(t, resp, "seq")
+	}
+}
+
+func TestIsDurable(t *testing.T) {
+	// Without a database nothing can be stored
+	assert.False(t, isDurable(WSResponse{Type: "message"}))
+	assert.True(t, ephemeralEvents["sync_complete"])
+	assert.False(t, ephemeralEvents["friend_request"])
+}
+
+func TestHandleMessage_RejectsLongClientMsgID(t *testing.T) {
+	hub := newTestHub()
+	phone := newTestDevice(hub, "Ualice", "Cphone")
+	laptop := newTestDevice(hub, "Ualice", "Claptop")
+
+	long := make([]byte, maxClientMsgIDLen+1)
+	for i := range long {
+		long[i] = 'x'
+	}
+	hub.handleMessage(&WSMessage{SendID: "Ualice", ClientMsgID: string(long), client: phone})
+
+	// Only the sending connection is told about the rejection
+	assert.Len(t, laptop.send, 0)
+
+	var resp struct {
+		Type string            `json:"type"`
+		Data map[string]string `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(<-phone.send, &resp))
+	assert.Equal(t, "nack", resp.Type)
+	assert.Equal(t, "invalid_request", resp.Data["code"])
+	assert.Equal(t, "clientMsgId is too long", resp.Data["reason"])
+}
+
+func TestSendError_Unwrap(t *testing.T) {
+	err := error(&SendError{"invalid_mention", mention.ErrMentionAllForbidden.Error(), mention.ErrMentionAllForbidden})
+
+	// REST callers still see the underlying error
+	assert.ErrorIs(t, err, mention.ErrMentionAllForbidden)
+
+	var sendErr *SendError
+	assert.True(t, errors.As(err, &sendErr))
+	assert.Equal(t, "invalid_mention", sendErr.Code)
+}
+
+func TestReply_ClosedConnection(t *testing.T) {
+	hub := newTestHub()
+	phone := newTestDevice(hub, "Ualice", "Cphone")
+	hub.removeClient(phone)
+
+	// Must not write to the closed send channel
+	assert.NotPanics(t, func() {
+		hub.nack(&WSMessage{SendID: "Ualice", client: phone}, "save_failed", "failed")
+	})
+}
+
+func TestMessageEvent_PerSession(t *testing.T) {
+	id := "c-1"
+	m := &model.Message{UUID: "M1", SendID: "Ualice", ReceiveID: "Ggroup", Content: "hi", ClientMsgID: &id}
+
+	payload := messagePayload(m, nil, nil)
+	event := messageEvent(payload, "Sbob")
+	data := event.Data.(map[string]interface{})
+
+	assert.Equal(t, "message", event.Type)
+	assert.Equal(t, "Sbob", data["sessionId"])
+	assert.Equal(t, "c-1", data["clientMsgId"])
+	assert.Equal(t, "hi", data["content"])
+	assert.NotContains(t, data, "replyTo")
+
+	// Addressing one recipient leaves the shared payload untouched
+	assert.NotContains(t, payload, "sessionId")
+}
+
+func TestMessagePayload_WithQuote(t *testing.T) {
+	m := &model.Message{UUID: "M2", ReplyToID: "M1"}
+	quote := &reply.Quote{UUID: "M1", SendName: "Bob", Content: "original"}
+
+	payload := messagePayload(m, quote, nil)
+
+	assert.Equal(t, "M1", payload["replyToId"])
+	assert.Equal(t, quote, payload["replyTo"])
+}
+
+func TestSendEach_DifferentResponses(t *testing.T) {
+	hub := newTestHub()
+	alice := newTestClient(hub, "Ualice")
+	bob := newTestClient(hub, "Ubob")
+
+	hub.sendEach(map[string]WSResponse{
+		"Ualice": {Type: "system", Data: "a"},
+		"Ubob":   {Type: "system", Data: "b"},
+	})
+
+	var resp WSResponse
+	assert.NoError(t, json.Unmarshal(<-alice.send, &resp))
+	assert.Equal(t, "a", resp.Data)
+	assert.NoError(t, json.Unmarshal(<-bob.send, &resp))
+	assert.Equal(t, "b", resp.Data)
+}
+
+func TestMessagePayload_WithLinkPreview(t *testing.T) {
+	m := &model.Message{UUID: "M3", Content: "https://example.com", LinkPreview: `{"url":"https://example.com","title":"Example"}`}
+
+	payload := messagePayload(m, nil, nil)
+
+	assert.Equal(t, "Example", payload["linkPreview"].(*linkpreview.Preview).Title)
+	assert.NotContains(t, messagePayload(&model.Message{UUID: "M4"}, nil, nil), "linkPreview")
+}
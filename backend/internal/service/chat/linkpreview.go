@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/linkpreview"
+)
+
+const (
+	// Number of link previews fetched at once
+	maxPreviewFetches = 8
+
+	// Messages waiting for a preview; beyond this new ones go without
+	previewQueueSize = 1024
+)
+
+// previewJob is a message waiting for the preview of its first link
+type previewJob struct {
+	msg  model.Message
+	link string
+}
+
+// QueueLinkPreview fetches a preview for the first link in a text message in
+// the background, stores it and sends the conversation a message_updated event
+func (h *Hub) QueueLinkPreview(m *model.Message) {
+	if m.Type != model.MessageTypeText || m.Recalled {
+		return
+	}
+	link := linkpreview.ExtractURL(m.Content)
+	if link == "" {
+		return
+	}
+
+	select {
+	case h.previews <- previewJob{*m, link}:
+	default:
+		log.Printf("Link preview queue full, skipping %s", m.UUID)
+	}
+}
+
+// fetchPreviews runs one link preview worker
+func (h *Hub) fetchPreviews() {
+	for job := range h.previews {
+		h.attachLinkPreview(&job.msg, job.link)
+	}
+}
+
+// attachLinkPreview stores a link's preview on a message and announces it
+func (h *Hub) attachLinkPreview(m *model.Message, link string) {
+	preview, err := linkpreview.Get(link)
+	if err != nil {
+		log.Printf("Failed to fetch link preview for %s: %v", m.UUID, err)
+		return
+	}
+	if preview == nil || database.DB == nil {
+		return
+	}
+
+	// Messages edited or recalled while the page loaded keep no stale preview
+	result := database.DB.Model(&model.Message{}).
+		Where("id = ? AND content = ? AND recalled = ?", m.ID, m.Content, false).
+		Update("link_preview", linkpreview.Encode(preview))
+	if result.Error != nil {
+		log.Printf("Failed to save link preview for %s: %v", m.UUID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	h.SendToConversation(m.SendID, m.ReceiveID, WSResponse{
+		Type: "message_updated",
+		Data: map[string]interface{}{
+			"uuid":        m.UUID,
+			"sendId":      m.SendID,
+			"receiveId":   m.ReceiveID,
+			"linkPreview": preview,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
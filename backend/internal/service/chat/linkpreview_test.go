@@ -0,0 +1,33 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueLinkPreview(t *testing.T) {
+	hub := newTestHub()
+
+	hub.QueueLinkPreview(&model.Message{UUID: "M1", Type: model.MessageTypeText, Content: "see https://example.com/a."})
+	hub.QueueLinkPreview(&model.Message{UUID: "M2", Type: model.MessageTypeText, Content: "no link"})
+	hub.QueueLinkPreview(&model.Message{UUID: "M3", Type: model.MessageTypeImage, URL: "https://example.com/b"})
+
+	assert.Len(t, hub.previews, 1)
+	job := <-hub.previews
+	assert.Equal(t, "M1", job.msg.UUID)
+	assert.Equal(t, "https://example.com/a", job.link)
+}
+
+func TestQueueLinkPreview_FullQueue(t *testing.T) {
+	hub := newTestHub()
+	m := &model.Message{UUID: "M1", Type: model.MessageTypeText, Content: "https://example.com"}
+	for i := 0; i < cap(hub.previews); i++ {
+		hub.QueueLinkPreview(m)
+	}
+
+	// A burst of links is skipped rather than piling up goroutines
+	hub.QueueLinkPreview(m)
+	assert.Len(t, hub.previews, cap(hub.previews))
+}
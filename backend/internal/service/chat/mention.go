@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+)
+
+// isMentionError reports whether err rejects the client's mentions
+func isMentionError(err error) bool {
+	return errors.Is(err, mention.ErrInvalidMention) ||
+		errors.Is(err, mention.ErrMentionAllForbidden) ||
+		errors.Is(err, mention.ErrTooManyMentions)
+}
+
+// notifyMentions flags the mentioned members' sessions and sends each of them a
+// mention event. sessionIDs holds every member's session UUID, keyed by member ID.
+func (h *Hub) notifyMentions(m *model.Message, sessionIDs map[string]string) {
+	members := make([]string, 0, len(sessionIDs))
+	for memberID := range sessionIDs {
+		members = append(members, memberID)
+	}
+
+	// Members who left since the message was checked are skipped
+	var recipients []string
+	for _, userID := range mention.Recipients(m, members) {
+		if _, ok := sessionIDs[userID]; ok {
+			recipients = append(recipients, userID)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	if err := session.MarkMentioned(m.ReceiveID, recipients); err != nil {
+		log.Printf("Failed to flag mentioned sessions: %v", err)
+	}
+
+	preview := session.Preview(m)
+	responses := make(map[string]WSResponse, len(recipients))
+	for _, userID := range recipients {
+		responses[userID] = WSResponse{
+			Type: "mention",
+			Data: map[string]interface{}{
+				"uuid":      m.UUID,
+				"sessionId": sessionIDs[userID],
+				"sendId":    m.SendID,
+				"sendName":  m.SendName,
+				"receiveId": m.ReceiveID,
+				"content":   preview,
+				"all":       m.MentionAll,
+			},
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	h.sendEach(responses)
+}
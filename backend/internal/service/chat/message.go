@@ -1,5 +1,7 @@
 package chat
 
+import "github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+
 // MessageType constants for WebSocket messages
 const (
 	MessageTypeText      = 0
@@ -10,8 +12,23 @@ const (
 	MessageTypeSystem    = 99
 )
 
+// Longest accepted client-generated message ID
+const maxClientMsgIDLen = 64
+
+// Inbound frame actions; an empty action sends a chat message
+const (
+	ActionSend = "send"
+	ActionSync = "sync"
+
+	// Ephemeral actions are relayed to the conversation but never stored
+	ActionTypingStart = "typing_start"
+	ActionTypingStop  = "typing_stop"
+)
+
 // WebSocket message structure sent between client and server
 type WSMessage struct {
+	Action     string `json:"action,omitempty"`     // Frame action, defaults to ActionSend
+	LastSeq    int64  `json:"lastSeq,omitempty"`    // Last seen event sequence (sync only)
 	Type       int    `json:"type"`                 // Message type
 	Content    string `json:"content,omitempty"`    // Text content
 	URL        string `json:"url,omitempty"`        // File/media URL
@@ -25,11 +42,37 @@ type WSMessage struct {
 	FileSize   int64  `json:"fileSize,omitempty"`   // File size in bytes
 	IsGroup    bool   `json:"isGroup,omitempty"`    // True if group message
 	AVData     string `json:"avData,omitempty"`     // WebRTC signaling data
+
+	// UUID of the message being replied to, in the same conversation
+	ReplyToID string `json:"replyToId,omitempty"`
+
+	// Users mentioned in a group message, in addition to @<user ID> in the content
+	Mentions []string `json:"mentions,omitempty"`
+
+	// Client-generated ID; resending the same ID does not create a duplicate
+	ClientMsgID string `json:"clientMsgId,omitempty"`
+
+	// Connection the message arrived on, used to address ack/nack replies
+	client *Client
+
+	// Voice metadata taken from the attached upload, never from the client
+	durationMs int64
+	waveform   string
+
+	// Validated mentions, set by handleMessage
+	mentions *mention.Mentions
+
+	// Original message credited by a forward; only the server sets it
+	forwarded *forwardSource
+
+	// Root of the thread a reply is posted in; only the server sets it
+	threadID string
 }
 
 // WSResponse is the response sent back to clients
 type WSResponse struct {
-	Type      string      `json:"type"`      // "message", "system", "error"
+	Type      string      `json:"type"` // "message", "system", "error", ...
 	Data      interface{} `json:"data"`
 	Timestamp int64       `json:"timestamp"`
+	Seq       int64       `json:"seq,omitempty"` // Per-user sequence of stored events
 }
@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// messageRef returns the UUID and sender of a chat message event, or empty
+// strings for any other event. Data is a map when built locally and raw JSON
+// when replayed from the event log.
+func messageRef(response WSResponse) (uuid, sendID string) {
+	if response.Type != "message" {
+		return "", ""
+	}
+
+	switch data := response.Data.(type) {
+	case map[string]interface{}:
+		uuid, _ = data["uuid"].(string)
+		sendID, _ = data["sendId"].(string)
+	case json.RawMessage:
+		var ref struct {
+			UUID   string `json:"uuid"`
+			SendID string `json:"sendId"`
+		}
+		if err := json.Unmarshal(data, &ref); err == nil {
+			uuid, sendID = ref.UUID, ref.SendID
+		}
+	}
+	return uuid, sendID
+}
+
+// Delivery receipts waiting to be stored, and the most stored in one batch
+const (
+	receiptQueueSize = 4096
+	maxReceiptBatch  = 500
+)
+
+// receipt is one message reaching one of its recipients
+type receipt struct {
+	messageID   string
+	recipientID string
+}
+
+// recordDeliveries marks messages delivered once they reach a recipient's
+// socket. Each message is recorded once, however many members received it.
+func (h *Hub) recordDeliveries(responses map[string]WSResponse, delivered []string) {
+	recorded := make(map[string]bool)
+	for _, userID := range delivered {
+		uuid, sendID := messageRef(responses[userID])
+		if uuid == "" || sendID == userID || recorded[uuid] {
+			continue
+		}
+		recorded[uuid] = true
+		h.recordDelivery(uuid, userID)
+	}
+}
+
+// recordDelivery queues a delivery receipt for the receipt worker, so the
+// hub loop never waits on the database for it. When the queue is full the
+// receipt is dropped; the message still reaches delivered once it is read.
+func (h *Hub) recordDelivery(messageUUID, recipientID string) {
+	select {
+	case h.receipts <- receipt{messageUUID, recipientID}:
+	default:
+		log.Printf("Receipt queue full, dropping delivery of %s", messageUUID)
+	}
+}
+
+// storeReceipts runs the receipt worker, storing queued receipts in batches
+func (h *Hub) storeReceipts() {
+	for r := range h.receipts {
+		batch := map[string]string{r.messageID: r.recipientID}
+
+		// Take whatever else is already waiting
+	drain:
+		for len(batch) < maxReceiptBatch {
+			select {
+			case r := <-h.receipts:
+				if _, ok := batch[r.messageID]; !ok {
+					batch[r.messageID] = r.recipientID
+				}
+			default:
+				break drain
+			}
+		}
+		h.markDelivered(batch)
+	}
+}
+
+// markDelivered moves sent messages to delivered and tells their senders.
+// batch maps message UUIDs to the recipient that got them first; messages
+// already delivered are skipped.
+func (h *Hub) markDelivered(batch map[string]string) {
+	if database.DB == nil {
+		return
+	}
+
+	uuids := make([]string, 0, len(batch))
+	for uuid := range batch {
+		uuids = append(uuids, uuid)
+	}
+
+	var msgs []model.Message
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if msgs, err = lockUndelivered(tx, uuids); err != nil || len(msgs) == 0 {
+			return err
+		}
+		ids := make([]int64, len(msgs))
+		for i, m := range msgs {
+			ids[i] = m.ID
+		}
+		return tx.Model(&model.Message{}).Where("id IN ?", ids).
+			Update("status", model.MessageStatusDelivered).Error
+	})
+	if err != nil {
+		log.Printf("Failed to mark messages delivered: %v", err)
+		return
+	}
+
+	deliveredAt := time.Now()
+	for _, msg := range msgs {
+		h.SendToUser(msg.SendID, WSResponse{
+			Type: "message_delivered",
+			Data: map[string]interface{}{
+				"uuid":        msg.UUID,
+				"receiveId":   msg.ReceiveID,
+				"userId":      batch[msg.UUID],
+				"deliveredAt": deliveredAt.Format("2006-01-02 15:04:05"),
+			},
+			Timestamp: deliveredAt.Unix(),
+		})
+	}
+}
+
+// lockUndelivered locks the given messages that are not yet delivered, so
+// two nodes receiving the same batch tell each sender only once
+func lockUndelivered(tx *gorm.DB, uuids []string) ([]model.Message, error) {
+	var msgs []model.Message
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "uuid", "send_id", "receive_id").
+		Where("uuid IN ? AND status < ?", uuids, model.MessageStatusDelivered).
+		Find(&msgs).Error
+	return msgs, err
+}
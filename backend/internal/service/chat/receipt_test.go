@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMessageRef(t *testing.T) {
+	local := WSResponse{Type: "message", Data: map[string]interface{}{"uuid": "M1", "sendId": "Ualice"}}
+	uuid, sendID := messageRef(local)
+	assert.Equal(t, "M1", uuid)
+	assert.Equal(t, "Ualice", sendID)
+
+	// Replayed events carry their payload as raw JSON
+	replayed := WSResponse{Type: "message", Data: json.RawMessage(`{"uuid":"M2","sendId":"Ubob"}`)}
+	uuid, sendID = messageRef(replayed)
+	assert.Equal(t, "M2", uuid)
+	assert.Equal(t, "Ubob", sendID)
+
+	uuid, _ = messageRef(WSResponse{Type: "reaction_added", Data: map[string]interface{}{"uuid": "M1"}})
+	assert.Empty(t, uuid)
+}
+
+func TestDeliverLocal_ReportsDelivery(t *testing.T) {
+	hub := newTestHub()
+	newTestClient(hub, "Ualice")
+
+	assert.True(t, hub.deliverLocal("Ualice", []byte("{}")))
+	assert.False(t, hub.deliverLocal("Ubob", []byte("{}")))
+}
+
+func TestRecordDeliveries_QueuesOncePerMessage(t *testing.T) {
+	hub := newTestHub()
+	payload := map[string]interface{}{"uuid": "M1", "sendId": "Ualice"}
+	responses := map[string]WSResponse{
+		"Ualice": {Type: "message", Data: payload},
+		"Ubob":   {Type: "message", Data: payload},
+		"Ucarol": {Type: "message", Data: payload},
+	}
+
+	hub.recordDeliveries(responses, []string{"Ualice", "Ubob", "Ucarol"})
+
+	// The sender's own copy doesn't count, and the group fan-out is one receipt
+	assert.Len(t, hub.receipts, 1)
+	assert.Equal(t, receipt{"M1", "Ubob"}, <-hub.receipts)
+}
+
+func TestRecordDelivery_FullQueue(t *testing.T) {
+	hub := newTestHub()
+	for i := 0; i < cap(hub.receipts); i++ {
+		hub.recordDelivery("M1", "Ubob")
+	}
+
+	// The hub loop must not block on a backed-up worker
+	assert.NotPanics(t, func() { hub.recordDelivery("M2", "Ubob") })
+	assert.Len(t, hub.receipts, cap(hub.receipts))
+}
+
+func TestLockUndelivered(t *testing.T) {
+	db := testutil.DryRunDB(t)
+
+	var sql string
+	assert.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	}))
+
+	_, err := lockUndelivered(db, []string{"M1", "M2"})
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "WHERE uuid IN ($1,$2) AND status < $3")
+	assert.Contains(t, sql, "FOR UPDATE")
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
+)
+
+// SaveThreadReply stores a reply in the thread under rootID after the same
+// checks as any other message, and resolves its mentions and attachment.
+// duplicate is true when a retried send returns the reply already stored.
+// Callers record the reply on its thread and send it with NotifyThreadReply.
+func (h *Hub) SaveThreadReply(msg *WSMessage, rootID string) (dbMsg *model.Message, duplicate bool, err error) {
+	if _, err := prepareMessage(msg); err != nil {
+		return nil, false, err
+	}
+	msg.threadID = rootID
+
+	dbMsg, duplicate, err = saveMessage(msg)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save thread reply: %w", err)
+	}
+	if !duplicate {
+		h.QueueLinkPreview(dbMsg)
+	}
+	return dbMsg, duplicate, nil
+}
+
+// NotifyThreadReply sends a new thread reply to the thread's followers only,
+// with the thread's updated reply count. Followers who are no longer in the
+// group are skipped.
+func (h *Hub) NotifyThreadReply(m *model.Message, followers []string, replyCount int) {
+	if len(followers) == 0 {
+		return
+	}
+
+	members, err := groupMembers(m.ReceiveID)
+	if err != nil {
+		log.Printf("Failed to get group members: %v", err)
+		return
+	}
+	h.notifyThreadReply(m, currentMembers(followers, members), replyCount)
+}
+
+func (h *Hub) notifyThreadReply(m *model.Message, followers []string, replyCount int) {
+	if len(followers) == 0 {
+		return
+	}
+
+	payload := messagePayload(m, nil, upload.MediaFor(m.URL))
+	payload["replyCount"] = replyCount
+
+	h.SendToUsers(followers, WSResponse{
+		Type:      "thread_reply",
+		Data:      payload,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// currentMembers keeps the users who are among a group's members
+func currentMembers(userIDs, members []string) []string {
+	isMember := make(map[string]bool, len(members))
+	for _, userID := range members {
+		isMember[userID] = true
+	}
+
+	result := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if isMember[userID] {
+			result = append(result, userID)
+		}
+	}
+	return result
+}
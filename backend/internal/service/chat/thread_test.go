@@ -0,0 +1,43 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyThreadReply_SkipsRemovedFollowers(t *testing.T) {
+	hub := newTestHub()
+	alice := newTestClient(hub, "Ualice")
+	bob := newTestClient(hub, "Ubob")
+
+	// Bob still follows the thread but was kicked from the group
+	followers := []string{"Ualice", "Ubob"}
+	members := []string{"Ualice", "Ucarol"}
+	reply := &model.Message{UUID: "M2", SendID: "Ucarol", ReceiveID: "Ggroup", ThreadID: "M1", Content: "secret"}
+	hub.notifyThreadReply(reply, currentMembers(followers, members), 1)
+
+	assert.Len(t, alice.send, 1)
+	assert.Len(t, bob.send, 0)
+}
+
+func TestCurrentMembers(t *testing.T) {
+	assert.Equal(t, []string{"Ualice"}, currentMembers([]string{"Ualice", "Ubob"}, []string{"Ucarol", "Ualice"}))
+	assert.Empty(t, currentMembers([]string{"Ubob"}, nil))
+}
+
+func TestSaveThreadReply_RunsSendChecks(t *testing.T) {
+	hub := newTestHub()
+	long := make([]byte, maxClientMsgIDLen+1)
+	for i := range long {
+		long[i] = 'x'
+	}
+
+	_, _, err := hub.SaveThreadReply(&WSMessage{SendID: "Ualice", ReceiveID: "Ggroup", ClientMsgID: string(long)}, "M1")
+
+	var sendErr *SendError
+	assert.True(t, errors.As(err, &sendErr))
+	assert.Equal(t, "invalid_request", sendErr.Code)
+}
@@ -0,0 +1,40 @@
+// Package conversation selects the messages of a direct chat or group, shared
+// by the services that read them and the sweeper that expires them
+package conversation
+
+import (
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+// Messages selects the messages of a conversation as seen by userID:
+// everything sent to the group for a group, or both directions of a direct chat
+func Messages(userID, receiveID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if session.IsGroupID(receiveID) {
+			return db.Where("receive_id = ?", receiveID)
+		}
+		return db.Where(
+			"(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)",
+			userID, receiveID, receiveID, userID,
+		)
+	}
+}
+
+// Timeline selects a conversation's main timeline as of now, leaving out
+// thread replies and messages that have expired but not yet been swept
+func Timeline(userID, receiveID string, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = Messages(userID, receiveID)(db).Where("thread_id = ?", "")
+		return Unexpired(now)(db)
+	}
+}
+
+// Unexpired leaves out messages whose retention period ended before now
+func Unexpired(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("expires_at IS NULL OR expires_at > ?", now)
+	}
+}
@@ -0,0 +1,49 @@
+package conversation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessages_Direct(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var messages []model.Message
+	stmt := db.Scopes(Messages("Ualice", "Ubob")).Find(&messages).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "(send_id = $1 AND receive_id = $2) OR (send_id = $3 AND receive_id = $4)")
+	assert.Equal(t, []interface{}{"Ualice", "Ubob", "Ubob", "Ualice"}, stmt.Vars)
+}
+
+func TestMessages_Group(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var messages []model.Message
+	stmt := db.Scopes(Messages("Ualice", "Ggroup")).Find(&messages).Statement
+
+	// Group history includes every member's messages, not just the viewer's
+	assert.Contains(t, stmt.SQL.String(), "receive_id = $1")
+	assert.NotContains(t, stmt.SQL.String(), "send_id")
+	assert.Equal(t, []interface{}{"Ggroup"}, stmt.Vars)
+}
+
+func TestTimeline_ExcludesThreadReplies(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var messages []model.Message
+	stmt := db.Scopes(Timeline("Ualice", "Ggroup", time.Now())).Find(&messages).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "receive_id = $1 AND thread_id = $2 AND (expires_at IS NULL OR expires_at > $3)")
+	assert.Equal(t, []interface{}{"Ggroup", ""}, stmt.Vars[:2])
+}
+
+func TestUnexpired(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	now := time.Date(2025, 5, 6, 7, 8, 9, 0, time.UTC)
+	var messages []model.Message
+	stmt := db.Scopes(Unexpired(now)).Where("uuid = ?", "M1").Find(&messages).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "uuid = $1 AND (expires_at IS NULL OR expires_at > $2)")
+	assert.Equal(t, []interface{}{"M1", now}, stmt.Vars)
+}
@@ -1,22 +1,28 @@
 package group
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/database"
 	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/pin"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 var (
-	ErrGroupNotFound    = errors.New("group not found")
-	ErrNotGroupOwner    = errors.New("not group owner")
-	ErrAlreadyInGroup   = errors.New("already in group")
-	ErrNotInGroup       = errors.New("not in group")
-	ErrGroupDissolved   = errors.New("group has been dissolved")
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrNotGroupOwner  = errors.New("not group owner")
+	ErrAlreadyInGroup = errors.New("already in group")
+	ErrNotInGroup     = errors.New("not in group")
+	ErrGroupDissolved = errors.New("group has been dissolved")
+	ErrNotGroupAdmin  = errors.New("not group owner or admin")
+	ErrOutranked      = errors.New("cannot manage a member with an equal or higher role")
 )
 
 // CreateRequest contains data for creating a group
@@ -34,6 +40,11 @@ type UpdateRequest struct {
 	AddMode *int8   `json:"addMode"`
 }
 
+// NicknameRequest sets the name a member goes by in one group
+type NicknameRequest struct {
+	Nickname string `json:"nickname" binding:"max=50"` // Empty falls back to the profile nickname
+}
+
 // GroupResponse contains group data for API response
 type GroupResponse struct {
 	UUID      string   `json:"uuid"`
@@ -45,16 +56,16 @@ type GroupResponse struct {
 	MemberCnt int      `json:"memberCnt"`
 	Members   []string `json:"members"`
 	CreatedAt string   `json:"createdAt"`
+
+	MessageTTL int `json:"messageTtl"` // Seconds new messages are kept; 0 keeps them forever
+
+	Pins []pin.PinResponse `json:"pins,omitempty"` // Pinned messages, shown to members under the notice
 }
 
 // Create creates a new group
 func Create(ownerID string, req CreateRequest) (*GroupResponse, error) {
 	groupUUID := "G" + uuid.New().String()[:11]
 
-	// Initial member list (just the owner)
-	members := []string{ownerID}
-	membersJSON, _ := json.Marshal(members)
-
 	group := model.Group{
 		UUID:      groupUUID,
 		Name:      req.Name,
@@ -62,12 +73,22 @@ func Create(ownerID string, req CreateRequest) (*GroupResponse, error) {
 		OwnerID:   ownerID,
 		AddMode:   req.AddMode,
 		Avatar:    fmt.Sprintf("https://api.dicebear.com/7.x/identicon/svg?seed=%s", groupUUID),
-		Members:   membersJSON,
 		MemberCnt: 1,
 		Status:    model.GroupStatusActive,
 	}
 
-	if err := database.DB.Create(&group).Error; err != nil {
+	// The group and its owner's membership are created together
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.GroupMember{
+			GroupID:  groupUUID,
+			UserID:   ownerID,
+			Role:     model.GroupRoleOwner,
+			JoinedAt: group.CreatedAt,
+		}).Error
+	}); err != nil {
 		return nil, fmt.Errorf("failed to create group: %w", err)
 	}
 
@@ -80,7 +101,9 @@ func Create(ownerID string, req CreateRequest) (*GroupResponse, error) {
 	}
 	database.DB.Create(&contact)
 
-	return toGroupResponse(&group), nil
+	resp := toGroupResponse(&group)
+	resp.Members = []string{ownerID}
+	return resp, nil
 }
 
 // GetByUUID retrieves a group by UUID
@@ -98,15 +121,15 @@ func GetByUUID(uuid string) (*model.Group, error) {
 	return &group, nil
 }
 
-// Update updates group info (owner only)
+// Update updates group info (owner or admin)
 func Update(groupUUID, userID string, req UpdateRequest) (*GroupResponse, error) {
 	group, err := GetByUUID(groupUUID)
 	if err != nil {
 		return nil, err
 	}
 
-	if group.OwnerID != userID {
-		return nil, ErrNotGroupOwner
+	if err := requireManager(group, userID); err != nil {
+		return nil, err
 	}
 
 	updates := make(map[string]interface{})
@@ -130,8 +153,36 @@ func Update(groupUUID, userID string, req UpdateRequest) (*GroupResponse, error)
 	}
 
 	// Reload group
-	group, _ = GetByUUID(groupUUID)
-	return toGroupResponse(group), nil
+	group, err = GetByUUID(groupUUID)
+	if err != nil {
+		return nil, err
+	}
+	return withMembers(group)
+}
+
+// SetMessageTTL sets how long new messages in a group are kept (owner or admin).
+// Messages already sent keep the expiry they were sent with.
+func SetMessageTTL(groupUUID, userID string, seconds int) (*GroupResponse, error) {
+	if err := session.ValidMessageTTL(seconds); err != nil {
+		return nil, err
+	}
+
+	group, err := GetByUUID(groupUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireManager(group, userID); err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.Model(&model.Group{}).Where("uuid = ?", groupUUID).
+		Update("message_ttl", seconds).Error; err != nil {
+		return nil, fmt.Errorf("failed to update message retention: %w", err)
+	}
+	group.MessageTTL = seconds
+
+	chat.GetHub().NotifyMessageTTL(userID, groupUUID, seconds)
+	return withMembers(group)
 }
 
 // Dissolve dissolves a group (owner only)
@@ -155,34 +206,46 @@ func Dissolve(groupUUID, userID string) error {
 		Where("contact_id = ? AND contact_type = ?", groupUUID, model.ContactTypeGroup).
 		Update("status", model.ContactStatusLeftGroup)
 
+	members, err := memberIDs(groupUUID)
+	if err != nil {
+		return err
+	}
+	notifyMembers(members, "group_dissolved", map[string]interface{}{
+		"groupId": groupUUID,
+	})
+
 	return nil
 }
 
-// AddMember adds a user to a group
+// AddMember adds a user to a group. The membership table's unique key on
+// (group, user) settles concurrent joins, and the member count is adjusted in
+// the same transaction as the membership row.
 func AddMember(groupUUID, userID string) error {
-	group, err := GetByUUID(groupUUID)
-	if err != nil {
+	if _, err := GetByUUID(groupUUID); err != nil {
 		return err
 	}
 
-	// Check if already a member
-	var members []string
-	json.Unmarshal(group.Members, &members)
-	for _, m := range members {
-		if m == userID {
-			return ErrAlreadyInGroup
-		}
+	if _, err := getMember(groupUUID, userID); err == nil {
+		return ErrAlreadyInGroup
+	} else if !errors.Is(err, ErrNotInGroup) {
+		return err
 	}
 
-	// Add to members
-	members = append(members, userID)
-	membersJSON, _ := json.Marshal(members)
-
-	// Update group
-	if err := database.DB.Model(&model.Group{}).Where("uuid = ?", groupUUID).Updates(map[string]interface{}{
-		"members":    membersJSON,
-		"member_cnt": len(members),
-	}).Error; err != nil {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.GroupMember{
+			GroupID:  groupUUID,
+			UserID:   userID,
+			Role:     model.GroupRoleMember,
+			JoinedAt: time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return adjustMemberCount(tx, groupUUID, 1)
+	}); err != nil {
+		// Lost a race with a concurrent join of the same user
+		if _, getErr := getMember(groupUUID, userID); getErr == nil {
+			return ErrAlreadyInGroup
+		}
 		return fmt.Errorf("failed to add member: %w", err)
 	}
 
@@ -195,19 +258,30 @@ func AddMember(groupUUID, userID string) error {
 	}
 	database.DB.Create(&contact)
 
+	members, err := memberIDs(groupUUID)
+	if err != nil {
+		return err
+	}
+	notifyMembers(members, "group_member_joined", map[string]interface{}{
+		"groupId": groupUUID,
+		"userId":  userID,
+	})
+
 	return nil
 }
 
-// RemoveMember removes a user from a group (owner kicks or user leaves)
+// RemoveMember removes a user from a group (owner or admin kicks, or user leaves)
 func RemoveMember(groupUUID, userID, removerID string) error {
 	group, err := GetByUUID(groupUUID)
 	if err != nil {
 		return err
 	}
 
-	// Only owner can kick others, anyone can remove themselves
-	if userID != removerID && group.OwnerID != removerID {
-		return ErrNotGroupOwner
+	// The owner and admins can kick members ranked below them, anyone can remove themselves
+	if userID != removerID {
+		if err := requireOutranks(group, removerID, userID); err != nil {
+			return err
+		}
 	}
 
 	// Owner cannot be removed
@@ -215,29 +289,26 @@ func RemoveMember(groupUUID, userID, removerID string) error {
 		return errors.New("owner cannot leave group, dissolve instead")
 	}
 
-	var members []string
-	json.Unmarshal(group.Members, &members)
-
-	// Find and remove member
-	found := false
-	for i, m := range members {
-		if m == userID {
-			members = append(members[:i], members[i+1:]...)
-			found = true
-			break
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("group_id = ? AND user_id = ?", groupUUID, userID).Delete(&model.GroupMember{})
+		if result.Error != nil {
+			return result.Error
 		}
+		if result.RowsAffected == 0 {
+			return ErrNotInGroup
+		}
+		// A former member must stop receiving replies in the group's threads
+		threads := tx.Model(&model.Thread{}).Select("root_id").Where("group_id = ?", groupUUID)
+		if err := tx.Where("user_id = ? AND root_id IN (?)", userID, threads).
+			Delete(&model.ThreadFollower{}).Error; err != nil {
+			return err
+		}
+		return adjustMemberCount(tx, groupUUID, -1)
+	})
+	if errors.Is(err, ErrNotInGroup) {
+		return err
 	}
-	if !found {
-		return ErrNotInGroup
-	}
-
-	membersJSON, _ := json.Marshal(members)
-
-	// Update group
-	if err := database.DB.Model(&model.Group{}).Where("uuid = ?", groupUUID).Updates(map[string]interface{}{
-		"members":    membersJSON,
-		"member_cnt": len(members),
-	}).Error; err != nil {
+	if err != nil {
 		return fmt.Errorf("failed to remove member: %w", err)
 	}
 
@@ -250,6 +321,21 @@ func RemoveMember(groupUUID, userID, removerID string) error {
 		Where("user_id = ? AND contact_id = ?", userID, groupUUID).
 		Update("status", status)
 
+	members, err := memberIDs(groupUUID)
+	if err != nil {
+		return err
+	}
+
+	eventType := "group_member_left"
+	if status == model.ContactStatusKicked {
+		eventType = "group_member_kicked"
+	}
+	notifyMembers(append(members, userID), eventType, map[string]interface{}{
+		"groupId":   groupUUID,
+		"userId":    userID,
+		"removedBy": removerID,
+	})
+
 	return nil
 }
 
@@ -260,23 +346,42 @@ func GetMembers(groupUUID string) ([]map[string]interface{}, error) {
 		return nil, err
 	}
 
-	var memberIDs []string
-	json.Unmarshal(group.Members, &memberIDs)
+	var rows []model.GroupMember
+	if err := database.DB.Where("group_id = ?", groupUUID).
+		Order("joined_at ASC, id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
 
+	userIDs := make([]string, len(rows))
+	for i, row := range rows {
+		userIDs[i] = row.UserID
+	}
 	var users []model.User
-	if err := database.DB.Where("uuid IN ?", memberIDs).
+	if err := database.DB.Where("uuid IN ?", userIDs).
 		Select("uuid", "nickname", "avatar").
 		Find(&users).Error; err != nil {
 		return nil, err
 	}
+	profiles := make(map[string]*model.User, len(users))
+	for i := range users {
+		profiles[users[i].UUID] = &users[i]
+	}
 
-	result := make([]map[string]interface{}, 0, len(users))
-	for _, u := range users {
+	result := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		u := profiles[row.UserID]
+		if u == nil {
+			continue
+		}
 		result = append(result, map[string]interface{}{
-			"uuid":     u.UUID,
-			"nickname": u.Nickname,
-			"avatar":   u.Avatar,
-			"isOwner":  u.UUID == group.OwnerID,
+			"uuid":          u.UUID,
+			"nickname":      u.Nickname,
+			"avatar":        u.Avatar,
+			"isOwner":       u.UUID == group.OwnerID,
+			"role":          row.Role, // 0: member, 1: admin, 2: owner
+			"groupNickname": row.Nickname,
+			"joinedAt":      row.JoinedAt.Format("2006-01-02 15:04:05"),
 		})
 	}
 
@@ -296,44 +401,90 @@ func Search(query string) ([]GroupResponse, error) {
 	for _, g := range groups {
 		result = append(result, *toGroupResponse(&g))
 	}
+	if err := attachMembers(result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
 // GetUserGroups returns all groups a user is a member of
 func GetUserGroups(userID string) ([]GroupResponse, error) {
-	var contacts []model.Contact
-	if err := database.DB.Where("user_id = ? AND contact_type = ? AND status = ?",
-		userID, model.ContactTypeGroup, model.ContactStatusNormal).
-		Find(&contacts).Error; err != nil {
+	var groups []model.Group
+	if err := database.DB.Scopes(userGroupsScope(userID)).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]GroupResponse, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *toGroupResponse(&g))
+	}
+	if err := attachMembers(result); err != nil {
+		return nil, err
+	}
+	if err := attachPins(result); err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
-	if len(contacts) == 0 {
-		return []GroupResponse{}, nil
+// userGroupsScope selects the active groups userID has a membership row in
+func userGroupsScope(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		memberships := db.Session(&gorm.Session{NewDB: true}).
+			Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+		return db.Where("uuid IN (?) AND status = ?", memberships, model.GroupStatusActive)
 	}
+}
 
-	groupIDs := make([]string, len(contacts))
-	for i, c := range contacts {
-		groupIDs[i] = c.ContactID
+// GetPins returns a group's pinned messages if userID may see them, or nil
+func GetPins(g *model.Group, userID string) []pin.PinResponse {
+	if permission.CanViewConversation(userID, g.UUID) != nil {
+		return nil
 	}
+	pins, err := pin.LoadForGroups([]string{g.UUID})
+	if err != nil {
+		return nil
+	}
+	return pins[g.UUID]
+}
 
-	var groups []model.Group
-	if err := database.DB.Where("uuid IN ? AND status = ?", groupIDs, model.GroupStatusActive).
-		Find(&groups).Error; err != nil {
-		return nil, err
+// attachPins loads the pinned messages of a list of groups in one query
+func attachPins(groups []GroupResponse) error {
+	uuids := make([]string, len(groups))
+	for i, g := range groups {
+		uuids[i] = g.UUID
 	}
 
-	result := make([]GroupResponse, 0, len(groups))
-	for _, g := range groups {
-		result = append(result, *toGroupResponse(&g))
+	pins, err := pin.LoadForGroups(uuids)
+	if err != nil {
+		return err
 	}
-	return result, nil
+	for i := range groups {
+		groups[i].Pins = pins[groups[i].UUID]
+	}
+	return nil
 }
 
-func toGroupResponse(g *model.Group) *GroupResponse {
-	var members []string
-	json.Unmarshal(g.Members, &members)
+// notifyMembers sends a group event to the given members over WebSocket
+func notifyMembers(members []string, eventType string, data map[string]interface{}) {
+	chat.GetHub().SendToUsers(members, chat.WSResponse{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+}
 
+// withMembers builds a group's response including its member list
+func withMembers(g *model.Group) (*GroupResponse, error) {
+	resp := []GroupResponse{*toGroupResponse(g)}
+	if err := attachMembers(resp); err != nil {
+		return nil, err
+	}
+	return &resp[0], nil
+}
+
+// toGroupResponse converts a group without its member list; see attachMembers
+func toGroupResponse(g *model.Group) *GroupResponse {
 	return &GroupResponse{
 		UUID:      g.UUID,
 		Name:      g.Name,
@@ -342,7 +493,8 @@ func toGroupResponse(g *model.Group) *GroupResponse {
 		OwnerID:   g.OwnerID,
 		AddMode:   g.AddMode,
 		MemberCnt: g.MemberCnt,
-		Members:   members,
 		CreatedAt: g.CreatedAt.Format("2006-01-02"),
+
+		MessageTTL: g.MessageTTL,
 	}
 }
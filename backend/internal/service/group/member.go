@@ -0,0 +1,190 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"gorm.io/gorm"
+)
+
+// SetAdmin promotes a member to admin, or demotes an admin back to a plain
+// member (owner only)
+func SetAdmin(groupUUID, memberID, ownerID string, admin bool) error {
+	group, err := GetByUUID(groupUUID)
+	if err != nil {
+		return err
+	}
+	if group.OwnerID != ownerID {
+		return ErrNotGroupOwner
+	}
+	if memberID == group.OwnerID {
+		return ErrOutranked
+	}
+
+	member, err := getMember(groupUUID, memberID)
+	if err != nil {
+		return err
+	}
+
+	role := int8(model.GroupRoleMember)
+	if admin {
+		role = model.GroupRoleAdmin
+	}
+	if member.Role == role {
+		return nil
+	}
+	if err := database.DB.Model(&model.GroupMember{}).Where("id = ?", member.ID).
+		Update("role", role).Error; err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	members, err := memberIDs(groupUUID)
+	if err != nil {
+		return err
+	}
+	notifyMembers(members, "group_member_role_changed", map[string]interface{}{
+		"groupId":   groupUUID,
+		"userId":    memberID,
+		"role":      role,
+		"changedBy": ownerID,
+	})
+	return nil
+}
+
+// SetNickname sets the name userID goes by in a group
+func SetNickname(groupUUID, userID, nickname string) error {
+	if _, err := GetByUUID(groupUUID); err != nil {
+		return err
+	}
+
+	member, err := getMember(groupUUID, userID)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Model(&model.GroupMember{}).Where("id = ?", member.ID).
+		Update("nickname", nickname).Error; err != nil {
+		return fmt.Errorf("failed to update group nickname: %w", err)
+	}
+
+	members, err := memberIDs(groupUUID)
+	if err != nil {
+		return err
+	}
+	notifyMembers(members, "group_member_nickname_changed", map[string]interface{}{
+		"groupId":  groupUUID,
+		"userId":   userID,
+		"nickname": nickname,
+	})
+	return nil
+}
+
+// requireManager allows only the group's owner and admins
+func requireManager(group *model.Group, userID string) error {
+	role, err := permission.GroupRole(group, userID)
+	if err != nil {
+		return err
+	}
+	if !permission.IsGroupManager(role) {
+		return ErrNotGroupAdmin
+	}
+	return nil
+}
+
+// requireOutranks allows a manager to act on a member ranked below them, so
+// admins can moderate members but not each other or the owner
+func requireOutranks(group *model.Group, actorID, targetID string) error {
+	actorRole, err := permission.GroupRole(group, actorID)
+	if err != nil {
+		return err
+	}
+	if !permission.IsGroupManager(actorRole) {
+		return ErrNotGroupAdmin
+	}
+
+	targetRole, err := permission.GroupRole(group, targetID)
+	if err != nil {
+		return err
+	}
+	if !outranks(actorRole, targetRole) {
+		return ErrOutranked
+	}
+	return nil
+}
+
+// outranks reports whether a member with one role may manage one with another
+func outranks(actorRole, targetRole int8) bool {
+	return actorRole > targetRole
+}
+
+// getMember loads userID's membership of a group
+func getMember(groupUUID, userID string) (*model.GroupMember, error) {
+	var member model.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupUUID, userID).
+		First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInGroup
+		}
+		return nil, fmt.Errorf("failed to get group member: %w", err)
+	}
+	return &member, nil
+}
+
+// memberIDs returns the user IDs of a group's members in the order they joined
+func memberIDs(groupUUID string) ([]string, error) {
+	members, err := memberIDsOf([]string{groupUUID})
+	if err != nil {
+		return nil, err
+	}
+	return members[groupUUID], nil
+}
+
+// memberIDsOf returns the member user IDs of several groups in one query,
+// keyed by group UUID
+func memberIDsOf(groupUUIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(groupUUIDs))
+	if len(groupUUIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []model.GroupMember
+	if err := database.DB.Select("group_id", "user_id").
+		Where("group_id IN ?", groupUUIDs).
+		Order("joined_at ASC, id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group members: %w", err)
+	}
+	for _, row := range rows {
+		result[row.GroupID] = append(result[row.GroupID], row.UserID)
+	}
+	return result, nil
+}
+
+// attachMembers fills in the member lists of a page of groups in one query
+func attachMembers(groups []GroupResponse) error {
+	uuids := make([]string, len(groups))
+	for i, g := range groups {
+		uuids[i] = g.UUID
+	}
+
+	members, err := memberIDsOf(uuids)
+	if err != nil {
+		return err
+	}
+	for i := range groups {
+		groups[i].Members = members[groups[i].UUID]
+		if groups[i].Members == nil {
+			groups[i].Members = []string{}
+		}
+	}
+	return nil
+}
+
+// adjustMemberCount changes a group's member count by delta. The update locks
+// the group's row, so concurrent joins and leaves can't lose a change.
+func adjustMemberCount(tx *gorm.DB, groupUUID string, delta int) error {
+	return tx.Model(&model.Group{}).Where("uuid = ?", groupUUID).
+		Update("member_cnt", gorm.Expr("member_cnt + ?", delta)).Error
+}
@@ -0,0 +1,28 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutranks(t *testing.T) {
+	assert.True(t, outranks(model.GroupRoleOwner, model.GroupRoleAdmin))
+	assert.True(t, outranks(model.GroupRoleAdmin, model.GroupRoleMember))
+
+	// Admins can't act on each other or on the owner
+	assert.False(t, outranks(model.GroupRoleAdmin, model.GroupRoleAdmin))
+	assert.False(t, outranks(model.GroupRoleAdmin, model.GroupRoleOwner))
+}
+
+func TestUserGroupsScope(t *testing.T) {
+	var groups []model.Group
+	stmt := testutil.DryRunDB(t).Scopes(userGroupsScope("Ualice")).Find(&groups).Statement
+
+	// Membership comes from group_members, and dissolved groups are left out
+	assert.Contains(t, stmt.SQL.String(),
+		`uuid IN (SELECT "group_id" FROM "group_members" WHERE user_id = $1) AND status = $2`)
+	assert.Equal(t, []interface{}{"Ualice", model.GroupStatusActive}, stmt.Vars)
+}
@@ -0,0 +1,151 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	// Total time allowed for one page fetch, redirects included
+	fetchTimeout = 5 * time.Second
+
+	// Only the start of a page is read; OpenGraph tags live in <head>
+	maxBodyBytes = 512 << 10
+
+	maxRedirects = 3
+)
+
+var (
+	ErrBlockedAddress = errors.New("link resolves to a non-public address")
+	ErrNotHTML        = errors.New("link is not an HTML page")
+)
+
+// Ranges that net/netip's predicates don't cover but that are not publicly routable
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach IPv4 private ranges
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// fetcher downloads pages through a client that only connects to allowed addresses
+type fetcher struct {
+	client *http.Client
+}
+
+var defaultFetcher = newFetcher(publicAddr)
+
+// newFetcher builds a fetcher whose connections are checked against allow.
+// The check runs on the resolved address of every dial, so redirects and
+// DNS answers that point inside the network are refused too.
+func newFetcher(allow func(netip.Addr) bool) *fetcher {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allow(addrPort.Addr().Unmap()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would make the dial check meaningless
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   fetchTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &fetcher{client: &http.Client{
+		Transport: transport,
+		Timeout:   fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if !validURL(req.URL.String()) {
+				return fmt.Errorf("redirect to unsupported URL")
+			}
+			return nil
+		},
+	}}
+}
+
+// publicAddr reports whether addr is a publicly routable unicast address
+func publicAddr(addr netip.Addr) bool {
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validURL accepts absolute http(s) URLs with a host and no credentials
+func validURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// fetch downloads the start of an HTML page and extracts its preview
+func (f *fetcher) fetch(rawURL string) (*Preview, error) {
+	if !validURL(rawURL) {
+		return nil, fmt.Errorf("unsupported link: %s", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "GoChatroom-LinkPreview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("link returned status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative image links resolve against the final URL after redirects
+	return parsePreview(resp.Request.URL, string(body)), nil
+}
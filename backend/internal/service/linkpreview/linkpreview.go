@@ -0,0 +1,142 @@
+package linkpreview
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	// Longest URL considered for a preview
+	maxURLLen = 2048
+
+	// How long fetched previews, and links without one, stay cached
+	cacheTTL      = 24 * time.Hour
+	emptyCacheTTL = time.Hour
+
+	// How long other nodes wait on a fetch already in progress elsewhere
+	lockTTL      = 2 * fetchTimeout
+	lockPollWait = 250 * time.Millisecond
+)
+
+// Preview is the OpenGraph-style summary of a linked page
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// ExtractURL returns the first http(s) link in text, or "" if there is none
+func ExtractURL(text string) string {
+	for _, candidate := range urlPattern.FindAllString(text, -1) {
+		// Punctuation ending a sentence is not part of the link
+		candidate = strings.TrimRight(candidate, ".,;:!?)]}")
+		if len(candidate) <= maxURLLen && validURL(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Get returns the preview for a link, fetching it at most once per cache period
+// across all nodes. It returns nil when the page has nothing to show.
+func Get(rawURL string) (*Preview, error) {
+	if redis.GetClient() == nil {
+		return defaultFetcher.fetch(rawURL)
+	}
+
+	key := cacheKey(rawURL)
+	if preview, ok := cached(key); ok {
+		return preview, nil
+	}
+
+	// Another node already fetching the link will fill the cache. The token
+	// keeps a fetch that outlived its lock from releasing someone else's.
+	lockKey, token := key+":lock", uuid.New().String()
+	locked, err := redis.SetNX(lockKey, token, lockTTL)
+	if err != nil {
+		log.Printf("Failed to lock link preview: %v", err)
+	} else if !locked {
+		for deadline := time.Now().Add(lockTTL); time.Now().Before(deadline); {
+			time.Sleep(lockPollWait)
+			if preview, ok := cached(key); ok {
+				return preview, nil
+			}
+		}
+		return nil, nil
+	}
+	defer func() {
+		if err := redis.DeleteIfValue(lockKey, token); err != nil {
+			log.Printf("Failed to release link preview lock: %v", err)
+		}
+	}()
+
+	preview, err := defaultFetcher.fetch(rawURL)
+	if err != nil {
+		// Failed links are cached as empty so they aren't retried for every message
+		redis.Set(key, "", emptyCacheTTL)
+		return nil, err
+	}
+	ttl := cacheTTL
+	if preview == nil {
+		ttl = emptyCacheTTL
+	}
+	if err := redis.Set(key, Encode(preview), ttl); err != nil {
+		log.Printf("Failed to cache link preview: %v", err)
+	}
+	return preview, nil
+}
+
+// cached reads a cached preview; ok is false when the link isn't cached
+func cached(key string) (*Preview, bool) {
+	exists, err := redis.Exists(key)
+	if err != nil || !exists {
+		return nil, false
+	}
+	value, err := redis.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	return Decode(value), true
+}
+
+// cacheKey hashes the URL so arbitrary links make bounded keys
+func cacheKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return "linkpreview:" + hex.EncodeToString(sum[:])
+}
+
+// Encode serializes a preview for storage; nil encodes as ""
+func Encode(p *Preview) string {
+	if p == nil {
+		return ""
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Decode parses a stored preview, returning nil for "" or malformed data
+func Decode(s string) *Preview {
+	if s == "" {
+		return nil
+	}
+	var p Preview
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil
+	}
+	return &p
+}
@@ -0,0 +1,104 @@
+package linkpreview
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleLen       = 200
+	maxDescriptionLen = 500
+	maxSiteNameLen    = 100
+)
+
+var (
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrPattern     = regexp.MustCompile(`(?is)([a-z_:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	headCloseTag    = regexp.MustCompile(`(?i)</head\s*>`)
+)
+
+// parsePreview extracts OpenGraph tags, falling back to Twitter cards and the
+// plain title and description. It returns nil when the page has no title or description.
+func parsePreview(pageURL *url.URL, page string) *Preview {
+	if loc := headCloseTag.FindStringIndex(page); loc != nil {
+		page = page[:loc[0]]
+	}
+	page = strings.ToValidUTF8(page, "")
+
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attrs := parseAttrs(tag)
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		// The first occurrence of a tag wins
+		if _, seen := meta[key]; key != "" && !seen {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	preview := &Preview{
+		URL:         pageURL.String(),
+		Title:       clean(firstOf(meta, "og:title", "twitter:title"), maxTitleLen),
+		Description: clean(firstOf(meta, "og:description", "twitter:description", "description"), maxDescriptionLen),
+		SiteName:    clean(meta["og:site_name"], maxSiteNameLen),
+		Image:       resolveImage(pageURL, firstOf(meta, "og:image", "og:image:url", "twitter:image")),
+	}
+	if preview.Title == "" {
+		if m := titleTagPattern.FindStringSubmatch(page); m != nil {
+			preview.Title = clean(html.UnescapeString(m[1]), maxTitleLen)
+		}
+	}
+
+	if preview.Title == "" && preview.Description == "" {
+		return nil
+	}
+	return preview
+}
+
+// parseAttrs returns a tag's attributes with lower-cased names and unescaped values
+func parseAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
+
+// firstOf returns the first non-blank value among keys
+func firstOf(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(meta[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean folds whitespace and truncates text to max runes
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+// resolveImage makes an image link absolute, dropping anything that isn't http(s)
+func resolveImage(pageURL *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := pageURL.Parse(ref)
+	if err != nil || len(u.String()) > maxURLLen || !validURL(u.String()) {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,286 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Number of bars in a voice message waveform
+const waveformBins = 64
+
+var (
+	ErrUnsupportedAudio = errors.New("unsupported audio format")
+	ErrMalformedAudio   = errors.New("malformed audio file")
+)
+
+// AudioInfo is the metadata extracted from a voice recording
+type AudioInfo struct {
+	DurationMs int64
+	Waveform   []byte // waveformBins amplitudes, 0-255
+}
+
+// AudioSupported reports whether duration and waveform can be extracted from a MIME type
+func AudioSupported(mimeType string) bool {
+	return mimeType == "audio/wave" || mimeType == "application/ogg"
+}
+
+// AnalyzeAudio extracts the duration and waveform of a WAV or Ogg (Opus or Vorbis) file
+func AnalyzeAudio(data []byte, mimeType string) (*AudioInfo, error) {
+	switch mimeType {
+	case "audio/wave":
+		return analyzeWAV(data)
+	case "application/ogg":
+		return analyzeOgg(data)
+	}
+	return nil, ErrUnsupportedAudio
+}
+
+// EncodeWaveform packs a waveform for storage
+func EncodeWaveform(waveform []byte) string {
+	return base64.StdEncoding.EncodeToString(waveform)
+}
+
+// DecodeWaveform unpacks a stored waveform into amplitudes clients can draw
+func DecodeWaveform(encoded string) []int {
+	if encoded == "" {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	result := make([]int, len(raw))
+	for i, v := range raw {
+		result[i] = int(v)
+	}
+	return result
+}
+
+// analyzeWAV reads PCM samples from a RIFF/WAVE file and takes the peak of each bin
+func analyzeWAV(data []byte) (*AudioInfo, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, ErrMalformedAudio
+	}
+
+	var format, channels, bitsPerSample uint16
+	var sampleRate uint32
+	var samples []byte
+	haveFormat := false
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			// Recorders streaming to disk may leave the size unset; take what's there
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrMalformedAudio
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = binary.LittleEndian.Uint16(body[2:4])
+			sampleRate = binary.LittleEndian.Uint32(body[4:8])
+			bitsPerSample = binary.LittleEndian.Uint16(body[14:16])
+			// WAVE_FORMAT_EXTENSIBLE keeps the real format in the sub-format GUID
+			if format == 0xFFFE && size >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+			haveFormat = true
+		case "data":
+			samples = body
+		}
+
+		// Chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if !haveFormat || samples == nil {
+		return nil, ErrMalformedAudio
+	}
+	if channels == 0 || sampleRate == 0 {
+		return nil, ErrMalformedAudio
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case format == 1 && bitsPerSample == 8:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == 1 && bitsPerSample == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case format == 1 && bitsPerSample == 24:
+		sample = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / 8388608
+		}
+	case format == 1 && bitsPerSample == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648 }
+	case format == 3 && bitsPerSample == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+
+	bytesPerSample := int(bitsPerSample / 8)
+	frameSize := bytesPerSample * int(channels)
+	frames := len(samples) / frameSize
+
+	peaks := make([]float64, waveformBins)
+	if frames > 0 {
+		for f := 0; f < frames; f++ {
+			bin := f * waveformBins / frames
+			for c := 0; c < int(channels); c++ {
+				off := f*frameSize + c*bytesPerSample
+				if v := math.Abs(sample(samples[off : off+bytesPerSample])); v > peaks[bin] {
+					peaks[bin] = v
+				}
+			}
+		}
+	}
+
+	return &AudioInfo{
+		DurationMs: int64(frames) * 1000 / int64(sampleRate),
+		Waveform:   normalizeWaveform(peaks),
+	}, nil
+}
+
+// oggPage is the part of an Ogg page header needed to time its packets
+type oggPage struct {
+	granule  int64
+	packets  [][]byte
+	dataSize int
+}
+
+// analyzeOgg times an Ogg Opus or Vorbis stream from its granule positions.
+// Decoding the audio would need a codec, so the waveform approximates
+// loudness from the compressed size of each stretch of the stream, which
+// tracks signal energy closely for variable-bitrate voice.
+func analyzeOgg(data []byte) (*AudioInfo, error) {
+	pages, err := readOggPages(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 || len(pages[0].packets) == 0 {
+		return nil, ErrMalformedAudio
+	}
+
+	head := pages[0].packets[0]
+	var rate, preSkip int64
+	headerPages := 0
+	switch {
+	case bytes.HasPrefix(head, []byte("OpusHead")) && len(head) >= 19:
+		// Opus granule positions always count 48 kHz samples
+		rate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(head[10:12]))
+		headerPages = 2 // OpusHead, OpusTags
+	case bytes.HasPrefix(head, []byte("\x01vorbis")) && len(head) >= 16:
+		rate = int64(binary.LittleEndian.Uint32(head[12:16]))
+		headerPages = 2 // Identification, then comment and setup
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+	if rate == 0 {
+		return nil, ErrMalformedAudio
+	}
+
+	last := int64(-1)
+	for _, p := range pages {
+		if p.granule > last {
+			last = p.granule
+		}
+	}
+	total := last - preSkip
+	if total <= 0 {
+		return nil, ErrMalformedAudio
+	}
+
+	weights := make([]float64, waveformBins)
+	if len(pages) > headerPages {
+		prev := int64(0)
+		for _, p := range pages[headerPages:] {
+			if p.granule < 0 {
+				continue
+			}
+			bin := int((p.granule - preSkip) * waveformBins / total)
+			if bin >= waveformBins {
+				bin = waveformBins - 1
+			}
+			if bin < 0 {
+				bin = 0
+			}
+			// Normalise by the page's duration so short pages don't look quiet
+			if span := p.granule - prev; span > 0 {
+				weights[bin] = math.Max(weights[bin], float64(p.dataSize)/float64(span))
+			}
+			prev = p.granule
+		}
+	}
+
+	return &AudioInfo{
+		DurationMs: total * 1000 / rate,
+		Waveform:   normalizeWaveform(weights),
+	}, nil
+}
+
+// readOggPages splits an Ogg stream into pages and the packets ending on each
+func readOggPages(data []byte) ([]oggPage, error) {
+	var pages []oggPage
+	for pos := 0; pos < len(data); {
+		if pos+27 > len(data) || string(data[pos:pos+4]) != "OggS" {
+			return nil, ErrMalformedAudio
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[pos+6 : pos+14]))
+		segments := int(data[pos+26])
+		if pos+27+segments > len(data) {
+			return nil, ErrMalformedAudio
+		}
+		table := data[pos+27 : pos+27+segments]
+
+		bodyStart := pos + 27 + segments
+		size := 0
+		for _, s := range table {
+			size += int(s)
+		}
+		if bodyStart+size > len(data) {
+			return nil, ErrMalformedAudio
+		}
+
+		page := oggPage{granule: granule, dataSize: size}
+		var packet []byte
+		off := bodyStart
+		for _, s := range table {
+			packet = append(packet, data[off:off+int(s)]...)
+			off += int(s)
+			// A lacing value under 255 ends a packet
+			if s < 255 {
+				page.packets = append(page.packets, packet)
+				packet = nil
+			}
+		}
+		pages = append(pages, page)
+		pos = bodyStart + size
+	}
+	return pages, nil
+}
+
+// normalizeWaveform scales values so the loudest bin is 255
+func normalizeWaveform(values []float64) []byte {
+	peak := 0.0
+	for _, v := range values {
+		peak = math.Max(peak, v)
+	}
+	result := make([]byte, len(values))
+	if peak == 0 {
+		return result
+	}
+	for i, v := range values {
+		result[i] = byte(math.Round(v / peak * 255))
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wav builds a 16-bit mono PCM file from samples
+func wav(sampleRate int, samples []int16) []byte {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+// oggPageBytes builds one Ogg page holding a single packet
+func oggPageBytes(granule int64, packet []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.WriteByte(0) // version
+	buf.WriteByte(0) // header type
+	binary.Write(&buf, binary.LittleEndian, granule)
+	binary.Write(&buf, binary.LittleEndian, []uint32{1, 0, 0}) // serial, sequence, checksum
+
+	var lacing []byte
+	n := len(packet)
+	for n >= 255 {
+		lacing = append(lacing, 255)
+		n -= 255
+	}
+	lacing = append(lacing, byte(n))
+	buf.WriteByte(byte(len(lacing)))
+	buf.Write(lacing)
+	buf.Write(packet)
+	return buf.Bytes()
+}
+
+func TestAnalyzeWAV(t *testing.T) {
+	// Two seconds at 8 kHz: silence, then a loud second
+	samples := make([]int16, 16000)
+	for i := 8000; i < 16000; i++ {
+		samples[i] = 16000
+	}
+
+	info, err := AnalyzeAudio(wav(8000, samples), "audio/wave")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2000), info.DurationMs)
+	assert.Len(t, info.Waveform, waveformBins)
+	assert.Equal(t, byte(0), info.Waveform[0])
+	assert.Equal(t, byte(255), info.Waveform[waveformBins-1])
+}
+
+func TestAnalyzeWAV_Malformed(t *testing.T) {
+	_, err := AnalyzeAudio([]byte("RIFF\x00\x00\x00\x00WAVE"), "audio/wave")
+	assert.ErrorIs(t, err, ErrMalformedAudio)
+}
+
+func TestAnalyzeOgg_Opus(t *testing.T) {
+	head := append([]byte("OpusHead"), 1, 1)
+	head = binary.LittleEndian.AppendUint16(head, 312) // pre-skip
+	head = append(head, make([]byte, 7)...)
+
+	var stream []byte
+	stream = append(stream, oggPageBytes(0, head)...)
+	stream = append(stream, oggPageBytes(0, []byte("OpusTags"))...)
+	stream = append(stream, oggPageBytes(312+48000, make([]byte, 10))...)
+	stream = append(stream, oggPageBytes(312+96000, make([]byte, 300))...)
+
+	info, err := AnalyzeAudio(stream, "application/ogg")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2000), info.DurationMs)
+	assert.Equal(t, byte(255), info.Waveform[waveformBins-1])
+}
+
+func TestAnalyzeAudio_Unsupported(t *testing.T) {
+	_, err := AnalyzeAudio([]byte("ID3"), "audio/mpeg")
+	assert.ErrorIs(t, err, ErrUnsupportedAudio)
+}
+
+func TestWaveformRoundTrip(t *testing.T) {
+	assert.Equal(t, []int{0, 128, 255}, DecodeWaveform(EncodeWaveform([]byte{0, 128, 255})))
+	assert.Nil(t, DecodeWaveform(""))
+}
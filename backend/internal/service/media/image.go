@@ -0,0 +1,157 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register GIF decoding
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	// Longest side of a generated thumbnail, in pixels
+	thumbnailSize = 320
+
+	// Longest side of the image a placeholder hash is computed from
+	blurHashSampleSize = 32
+
+	// Images larger than this are not decoded, to bound memory use
+	maxImagePixels = 50_000_000
+)
+
+// imageResult is what processing an image produces
+type imageResult struct {
+	Width       int
+	Height      int
+	BlurHash    string
+	Thumbnail   []byte
+	ContentType string
+}
+
+// processImage decodes an image and builds its thumbnail and placeholder
+func processImage(r io.Reader, mimeType string) (*imageResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	// Check the size from the header before decoding the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image is too large to process: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	src := toNRGBA(img)
+
+	result := &imageResult{
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		BlurHash: blurHash(resize(src, blurHashSampleSize), blurHashX, blurHashY),
+	}
+
+	var buf bytes.Buffer
+	thumb := resize(src, thumbnailSize)
+	result.ContentType = ThumbnailType(mimeType)
+	if result.ContentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	result.Thumbnail = buf.Bytes()
+
+	return result, nil
+}
+
+// ThumbnailType returns the MIME type of thumbnails made from an image type.
+// JPEG has no transparency, so only photos are re-encoded as JPEG.
+func ThumbnailType(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// decodable reports whether processImage can handle a MIME type
+func decodable(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// resize scales src to fit within maxSide pixels, averaging the source
+// pixels each destination pixel covers. Smaller images are returned as is.
+func resize(src *image.NRGBA, maxSide int) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, sh*maxSide/sw
+	if sh > sw {
+		dw, dh = sw*maxSide/sh, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(src.Bounds().Min.X+x0, src.Bounds().Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func solidImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestEncode83(t *testing.T) {
+	assert.Equal(t, "L", encode83(21, 1))
+	assert.Equal(t, "TSUA", encode83(0xFFFFFF, 4))
+}
+
+func TestBlurHash_SolidColor(t *testing.T) {
+	hash := blurHash(solidImage(8, 6, color.NRGBA{255, 255, 255, 255}), blurHashX, blurHashY)
+
+	// Size flag, max AC value, DC colour, then 11 AC components
+	assert.Len(t, hash, 2+4+2*(blurHashX*blurHashY-1))
+	assert.Equal(t, "L", hash[:1])
+	assert.Equal(t, "TSUA", hash[2:6])
+}
+
+func TestResize_KeepsAspectRatio(t *testing.T) {
+	img := resize(solidImage(1000, 500, color.NRGBA{10, 20, 30, 255}), 320)
+	assert.Equal(t, 320, img.Bounds().Dx())
+	assert.Equal(t, 160, img.Bounds().Dy())
+	assert.Equal(t, color.NRGBA{10, 20, 30, 255}, img.NRGBAAt(100, 100))
+
+	small := solidImage(10, 10, color.NRGBA{})
+	assert.Same(t, small, resize(small, 320))
+}
+
+func TestProcessImage(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, solidImage(640, 480, color.NRGBA{200, 0, 0, 255})))
+
+	result, err := processImage(&buf, "image/png")
+	assert.NoError(t, err)
+	assert.Equal(t, 640, result.Width)
+	assert.Equal(t, 480, result.Height)
+	assert.NotEmpty(t, result.BlurHash)
+	assert.Equal(t, "image/png", result.ContentType)
+
+	thumb, err := png.Decode(bytes.NewReader(result.Thumbnail))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 320, 240), thumb.Bounds())
+}
+
+func TestProcessImage_RejectsGarbage(t *testing.T) {
+	_, err := processImage(bytes.NewReader([]byte("not an image")), "image/png")
+	assert.Error(t, err)
+}
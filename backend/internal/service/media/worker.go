@@ -0,0 +1,113 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// Number of uploads processed concurrently
+	workerCount = 2
+
+	// Uploads waiting for a worker; beyond this new work is dropped and
+	// left to on-demand regeneration
+	queueSize = 256
+)
+
+var queue = make(chan string, queueSize)
+
+// Supported reports whether metadata can be extracted from files of a MIME type
+func Supported(mimeType string) bool {
+	return decodable(mimeType)
+}
+
+// Start runs the media workers and requeues uploads left pending by a previous run
+func Start() {
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			for uploadUUID := range queue {
+				if err := Process(uploadUUID); err != nil {
+					log.Printf("Failed to process media %s: %v", uploadUUID, err)
+				}
+			}
+		}()
+	}
+
+	var pending []string
+	if err := database.DB.Model(&model.Upload{}).
+		Where("media_status = ?", model.MediaStatusPending).
+		Order("id DESC").
+		Limit(queueSize).
+		Pluck("uuid", &pending).Error; err != nil {
+		log.Printf("Failed to load pending media: %v", err)
+		return
+	}
+	for _, uploadUUID := range pending {
+		Enqueue(uploadUUID)
+	}
+}
+
+// Enqueue schedules an upload for background processing
+func Enqueue(uploadUUID string) {
+	select {
+	case queue <- uploadUUID:
+	default:
+		log.Printf("Media queue full, skipping %s", uploadUUID)
+	}
+}
+
+// Process extracts an upload's media metadata and stores its thumbnail.
+// It can be run again to regenerate them.
+func Process(uploadUUID string) error {
+	var record model.Upload
+	if err := database.DB.Where("uuid = ?", uploadUUID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !Supported(record.MimeType) {
+		return nil
+	}
+
+	ctx := context.Background()
+	original, err := storage.Get().Get(ctx, record.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open original: %w", err)
+	}
+	result, err := processImage(original, record.MimeType)
+	original.Close()
+	if err != nil {
+		markFailed(record.ID)
+		return err
+	}
+
+	thumbnailKey := record.StorageKey + ".thumb"
+	if err := storage.Get().Put(ctx, thumbnailKey, bytes.NewReader(result.Thumbnail),
+		int64(len(result.Thumbnail)), result.ContentType); err != nil {
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+
+	return database.DB.Model(&model.Upload{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+		"media_status":  model.MediaStatusReady,
+		"width":         result.Width,
+		"height":        result.Height,
+		"blur_hash":     result.BlurHash,
+		"thumbnail_key": thumbnailKey,
+	}).Error
+}
+
+func markFailed(uploadID int64) {
+	if err := database.DB.Model(&model.Upload{}).Where("id = ?", uploadID).
+		Update("media_status", model.MediaStatusFailed).Error; err != nil {
+		log.Printf("Failed to mark media failed: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package mention
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+)
+
+var (
+	ErrInvalidMention      = errors.New("mentioned user is not a member of this group")
+	ErrMentionAllForbidden = errors.New("only the group owner or admins can mention everyone")
+	ErrTooManyMentions     = errors.New("too many mentions in one message")
+)
+
+// Most users one message may mention individually
+const maxMentions = 50
+
+// Mentions are the users a group message calls out
+type Mentions struct {
+	UserIDs []string
+	All     bool
+}
+
+// "@all" or "@<user ID>", not preceded by a word character (so emails don't match)
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(all|U[0-9a-f]{8}-[0-9a-f]{2})\b`)
+
+// Parse returns the user IDs mentioned in content and whether it mentions everyone
+func Parse(content string) (userIDs []string, all bool) {
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if m[1] == "all" {
+			all = true
+			continue
+		}
+		userIDs = append(userIDs, m[1])
+	}
+	return userIDs, all
+}
+
+// Resolve combines the mentions in a group message's content with the client's
+// explicit list and checks them against the group. Direct messages have no
+// mentions. The sender mentioning themselves is ignored.
+func Resolve(senderID, receiveID, content string, explicit []string) (*Mentions, error) {
+	if !session.IsGroupID(receiveID) {
+		return &Mentions{}, nil
+	}
+
+	parsed, all := Parse(content)
+	candidates := append(parsed, explicit...)
+	if len(candidates) == 0 && !all {
+		return &Mentions{}, nil
+	}
+
+	var group model.Group
+	if err := database.DB.Where("uuid = ?", receiveID).Select("uuid", "owner_id").
+		First(&group).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	var members []string
+	if err := database.DB.Model(&model.GroupMember{}).Where("group_id = ?", receiveID).
+		Pluck("user_id", &members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group members: %w", err)
+	}
+
+	// Only @all depends on the sender's role
+	role := int8(model.GroupRoleMember)
+	if all {
+		r, err := permission.GroupRole(&group, senderID)
+		if err != nil {
+			return nil, err
+		}
+		role = r
+	}
+
+	return check(senderID, role, members, candidates, all)
+}
+
+// check validates mentions against the sender's role and the group's members
+func check(senderID string, role int8, members, candidates []string, all bool) (*Mentions, error) {
+	if all && !CanMentionAll(role) {
+		return nil, ErrMentionAllForbidden
+	}
+
+	isMember := make(map[string]bool, len(members))
+	for _, m := range members {
+		isMember[m] = true
+	}
+
+	result := &Mentions{All: all}
+	seen := make(map[string]bool, len(candidates))
+	for _, userID := range candidates {
+		if userID == senderID || seen[userID] {
+			continue
+		}
+		if !isMember[userID] {
+			return nil, ErrInvalidMention
+		}
+		seen[userID] = true
+		result.UserIDs = append(result.UserIDs, userID)
+	}
+	if len(result.UserIDs) > maxMentions {
+		return nil, ErrTooManyMentions
+	}
+	return result, nil
+}
+
+// CanMentionAll reports whether a member with this role may notify every
+// member of a group; only the owner and admins may
+func CanMentionAll(role int8) bool {
+	return permission.IsGroupManager(role)
+}
+
+// Apply stores mentions on a message before it is saved
+func (m *Mentions) Apply(msg *model.Message) {
+	msg.MentionAll = m.All
+	msg.Mentions = Encode(m.UserIDs)
+}
+
+// Encode serializes mentioned user IDs for storage; none encodes as ""
+func Encode(userIDs []string) string {
+	if len(userIDs) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(userIDs)
+	return string(data)
+}
+
+// Decode parses stored mentioned user IDs
+func Decode(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var userIDs []string
+	if err := json.Unmarshal([]byte(s), &userIDs); err != nil {
+		return nil
+	}
+	return userIDs
+}
+
+// Recipients returns who a saved message notifies: every member but the sender
+// for @all, otherwise the individually mentioned users
+func Recipients(msg *model.Message, members []string) []string {
+	if !msg.MentionAll {
+		return Decode(msg.Mentions)
+	}
+	recipients := make([]string, 0, len(members))
+	for _, m := range members {
+		if m != msg.SendID {
+			recipients = append(recipients, m)
+		}
+	}
+	return recipients
+}
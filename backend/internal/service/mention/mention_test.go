@@ -0,0 +1,59 @@
+package mention
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	ids, all := Parse("@U1234abcd-ef hi @Uaaaabbbb-cc, and @all!")
+	assert.Equal(t, []string{"U1234abcd-ef", "Uaaaabbbb-cc"}, ids)
+	assert.True(t, all)
+
+	// Email addresses and partial words are not mentions
+	ids, all = Parse("mail bob@all.com or @allison")
+	assert.Empty(t, ids)
+	assert.False(t, all)
+}
+
+func TestCheck(t *testing.T) {
+	members := []string{"Uowner", "Ualice", "Ubob"}
+
+	m, err := check("Ualice", model.GroupRoleMember, members, []string{"Ubob", "Ualice", "Ubob"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Ubob"}, m.UserIDs)
+
+	_, err = check("Ualice", model.GroupRoleMember, members, []string{"Ucarol"}, false)
+	assert.ErrorIs(t, err, ErrInvalidMention)
+
+	_, err = check("Ualice", model.GroupRoleMember, members, nil, true)
+	assert.ErrorIs(t, err, ErrMentionAllForbidden)
+
+	m, err = check("Uowner", model.GroupRoleOwner, members, nil, true)
+	assert.NoError(t, err)
+	assert.True(t, m.All)
+
+	// Admins may mention everyone too
+	m, err = check("Ualice", model.GroupRoleAdmin, members, nil, true)
+	assert.NoError(t, err)
+	assert.True(t, m.All)
+}
+
+func TestRecipients(t *testing.T) {
+	members := []string{"Uowner", "Ualice", "Ubob"}
+
+	msg := &model.Message{SendID: "Uowner"}
+	(&Mentions{UserIDs: []string{"Ubob"}}).Apply(msg)
+	assert.Equal(t, []string{"Ubob"}, Recipients(msg, members))
+
+	msg.MentionAll = true
+	assert.Equal(t, []string{"Ualice", "Ubob"}, Recipients(msg, members))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	assert.Equal(t, "", Encode(nil))
+	assert.Nil(t, Decode(""))
+	assert.Equal(t, []string{"U1", "U2"}, Decode(Encode([]string{"U1", "U2"})))
+}
@@ -0,0 +1,183 @@
+package message
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/config"
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/pin"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotMessageSender    = errors.New("not message sender")
+	ErrMessageRecalled     = errors.New("message has been recalled")
+	ErrMessageNotEditable  = errors.New("only text messages can be edited")
+	ErrEditWindowExpired   = errors.New("edit window has expired")
+	ErrRecallWindowExpired = errors.New("recall window has expired")
+	ErrEmptyMessageContent = errors.New("message content cannot be empty")
+)
+
+// EditRequest contains the new content for a message
+type EditRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// Edit replaces the content of a text message sent by userID within the edit window
+func Edit(messageUUID, userID string, req EditRequest) (*MessageResponse, error) {
+	if req.Content == "" {
+		return nil, ErrEmptyMessageContent
+	}
+
+	msg, err := getOwnMessage(messageUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != model.MessageTypeText {
+		return nil, ErrMessageNotEditable
+	}
+	window := time.Duration(config.Get().Message.EditWindowMinutes) * time.Minute
+	if !withinWindow(msg.CreatedAt, window, time.Now()) {
+		return nil, ErrEditWindowExpired
+	}
+
+	editedAt := sql.NullTime{Time: time.Now(), Valid: true}
+	updates := map[string]interface{}{
+		"content":      req.Content,
+		"edited_at":    editedAt,
+		"link_preview": "",
+	}
+	// Keep the content as first sent; later edits don't overwrite it
+	if !msg.EditedAt.Valid {
+		updates["original_content"] = msg.Content
+	}
+	if err := database.DB.Model(&model.Message{}).Where("id = ?", msg.ID).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to edit message: %w", err)
+	}
+	msg.Content = req.Content
+	msg.EditedAt = editedAt
+	msg.LinkPreview = ""
+
+	refreshPreviewIfLatest(msg, session.Preview(msg))
+
+	chat.GetHub().SendToConversation(msg.SendID, msg.ReceiveID, chat.WSResponse{
+		Type: "message_edited",
+		Data: map[string]interface{}{
+			"uuid":      msg.UUID,
+			"sendId":    msg.SendID,
+			"receiveId": msg.ReceiveID,
+			"content":   msg.Content,
+			"editedAt":  msg.EditedAt.Time.Format("2006-01-02 15:04:05"),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+
+	// The edited text may link somewhere else
+	chat.GetHub().QueueLinkPreview(msg)
+
+	return toMessageResponse(msg), nil
+}
+
+// Recall withdraws a message sent by userID within the recall window, clearing its content
+func Recall(messageUUID, userID string) (*MessageResponse, error) {
+	msg, err := getOwnMessage(messageUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	window := time.Duration(config.Get().Message.RecallWindowMinutes) * time.Minute
+	if !withinWindow(msg.CreatedAt, window, time.Now()) {
+		return nil, ErrRecallWindowExpired
+	}
+
+	// The earlier text must not survive anywhere: not as the pre-edit
+	// original, nor in events that sync would replay
+	recalledAt := sql.NullTime{Time: time.Now(), Valid: true}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Message{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+			"recalled":         true,
+			"recalled_at":      recalledAt,
+			"content":          "",
+			"original_content": "",
+			"url":              "",
+			"file_type":        "",
+			"file_name":        "",
+			"file_size":        0,
+			"duration_ms":      0,
+			"waveform":         "",
+			"link_preview":     "",
+		}).Error; err != nil {
+			return err
+		}
+		return chat.ForgetMessages(tx, []string{msg.UUID})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recall message: %w", err)
+	}
+	msg.Recalled = true
+	msg.RecalledAt = recalledAt
+	msg.Content, msg.OriginalContent, msg.URL, msg.FileType, msg.FileName, msg.FileSize = "", "", "", "", "", 0
+	msg.DurationMs, msg.Waveform, msg.LinkPreview = 0, "", ""
+
+	refreshPreviewIfLatest(msg, session.RecalledPreview)
+	pin.RemoveForMessage(msg)
+
+	chat.GetHub().SendToConversation(msg.SendID, msg.ReceiveID, chat.WSResponse{
+		Type: "message_recalled",
+		Data: map[string]interface{}{
+			"uuid":       msg.UUID,
+			"sendId":     msg.SendID,
+			"receiveId":  msg.ReceiveID,
+			"recalledAt": msg.RecalledAt.Time.Format("2006-01-02 15:04:05"),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+
+	return toMessageResponse(msg), nil
+}
+
+// getOwnMessage loads a message that userID sent and that is still live
+func getOwnMessage(messageUUID, userID string) (*model.Message, error) {
+	msg, err := GetByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SendID != userID {
+		return nil, ErrNotMessageSender
+	}
+	if msg.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	return msg, nil
+}
+
+// withinWindow reports whether now is within window of sentAt; a non-positive window never closes
+func withinWindow(sentAt time.Time, window time.Duration, now time.Time) bool {
+	if window <= 0 {
+		return true
+	}
+	return now.Sub(sentAt) <= window
+}
+
+// refreshPreviewIfLatest updates the conversation's session previews when msg
+// is the most recent message, so the list doesn't show stale content
+func refreshPreviewIfLatest(msg *model.Message, preview string) {
+	var latest model.Message
+	if err := database.DB.Scopes(conversation.Timeline(msg.SendID, msg.ReceiveID, time.Now())).
+		Order("created_at DESC, id DESC").
+		Select("uuid").
+		First(&latest).Error; err != nil || latest.UUID != msg.UUID {
+		return
+	}
+
+	if session.IsGroupID(msg.ReceiveID) {
+		preview = session.GroupPreview(msg.SendName, preview)
+	}
+	session.SetConversationPreview(msg.SendID, msg.ReceiveID, preview)
+}
@@ -0,0 +1,120 @@
+package message
+
+import (
+	"errors"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNothingToForward = errors.New("no messages or targets to forward")
+	ErrTooManyForwards  = errors.New("too many messages or targets in one forward")
+	ErrNotForwardable   = errors.New("message cannot be forwarded")
+)
+
+// Limits on one forward request
+const (
+	maxForwardMessages = 20
+	maxForwardTargets  = 10
+)
+
+// ForwardRequest lists messages to copy into other conversations
+type ForwardRequest struct {
+	MessageIDs []string `json:"messageIds" binding:"required"`
+	TargetIDs  []string `json:"targetIds" binding:"required"` // User or group UUIDs
+}
+
+// Forward copies messages userID can see into every target conversation, in
+// their original order. All sources and targets are checked before anything
+// is sent. It returns the new messages, grouped by target.
+func Forward(userID, nickname, avatar string, req ForwardRequest) ([]MessageResponse, error) {
+	messageIDs, targetIDs := uniqueIDs(req.MessageIDs), uniqueIDs(req.TargetIDs)
+	if len(messageIDs) == 0 || len(targetIDs) == 0 {
+		return nil, ErrNothingToForward
+	}
+	if len(messageIDs) > maxForwardMessages || len(targetIDs) > maxForwardTargets {
+		return nil, ErrTooManyForwards
+	}
+
+	// A message that has expired but not yet been swept is gone; copying it
+	// into a conversation without retention would keep it forever
+	var sources []model.Message
+	if err := database.DB.Scopes(forwardSourcesScope(messageIDs, time.Now())).
+		Find(&sources).Error; err != nil {
+		return nil, err
+	}
+	if len(sources) != len(messageIDs) {
+		return nil, ErrMessageNotFound
+	}
+	for i := range sources {
+		if err := permission.CanView(userID, &sources[i]); err != nil {
+			return nil, err
+		}
+		if !forwardable(&sources[i]) {
+			return nil, ErrNotForwardable
+		}
+	}
+	for _, targetID := range targetIDs {
+		if err := permission.CanSend(userID, targetID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	hub := chat.GetHub()
+	result := make([]MessageResponse, 0, len(sources)*len(targetIDs))
+	for _, targetID := range targetIDs {
+		for i := range sources {
+			dbMsg, err := hub.Forward(userID, nickname, avatar, &sources[i], targetID)
+			if err != nil {
+				return nil, err
+			}
+			resp := toMessageResponse(dbMsg)
+			if dbMsg.URL != "" {
+				resp.Media = upload.MediaFor(dbMsg.URL)
+			}
+			result = append(result, *resp)
+		}
+	}
+	return result, nil
+}
+
+// forwardSourcesScope selects the unexpired messages among messageIDs, oldest first
+func forwardSourcesScope(messageIDs []string, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return conversation.Unexpired(now)(db.Where("uuid IN ?", messageIDs)).
+			Order("created_at ASC, id ASC")
+	}
+}
+
+// forwardable reports whether a message's content can be copied elsewhere
+func forwardable(m *model.Message) bool {
+	if m.Recalled {
+		return false
+	}
+	switch m.Type {
+	case model.MessageTypeText, model.MessageTypeVoice, model.MessageTypeFile, model.MessageTypeImage:
+		return true
+	}
+	return false
+}
+
+// uniqueIDs drops blank and repeated IDs, keeping the first occurrence
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package message
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardable(t *testing.T) {
+	assert.True(t, forwardable(&model.Message{Type: model.MessageTypeText}))
+	assert.True(t, forwardable(&model.Message{Type: model.MessageTypeImage}))
+	assert.False(t, forwardable(&model.Message{Type: model.MessageTypeVideoCall}))
+	assert.False(t, forwardable(&model.Message{Type: model.MessageTypeText, Recalled: true}))
+}
+
+func TestUniqueIDs(t *testing.T) {
+	assert.Equal(t, []string{"M1", "M2"}, uniqueIDs([]string{"M1", "", "M2", "M1"}))
+	assert.Empty(t, uniqueIDs(nil))
+}
+
+func TestForwardSourcesScope_SkipsExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var messages []model.Message
+	stmt := testutil.DryRunDB(t).Scopes(forwardSourcesScope([]string{"M1", "M2"}, now)).Find(&messages).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "uuid IN ($1,$2) AND (expires_at IS NULL OR expires_at > $3)")
+	assert.Equal(t, now, stmt.Vars[2])
+}
@@ -1,32 +1,55 @@
 package message
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/database"
 	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/linkpreview"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/media"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
 	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
-	"github.com/google/uuid"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
 	"gorm.io/gorm"
 )
 
 var (
 	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidCursor   = errors.New("invalid history cursor")
+)
+
+// History page sizes
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
 )
 
 // CreateRequest contains data for creating a message
 type CreateRequest struct {
-	SessionID  string `json:"sessionId" binding:"required"`
-	ReceiveID  string `json:"receiveId" binding:"required"`
-	Type       int8   `json:"type"`                 // 0: text, 1: voice, 2: file, 3: image
-	Content    string `json:"content"`
-	URL        string `json:"url,omitempty"`
-	FileType   string `json:"fileType,omitempty"`
-	FileName   string `json:"fileName,omitempty"`
-	FileSize   int64  `json:"fileSize,omitempty"`
+	SessionID string `json:"sessionId" binding:"required"`
+	ReceiveID string `json:"receiveId" binding:"required"`
+	Type      int8   `json:"type"` // 0: text, 1: voice, 2: file, 3: image
+	Content   string `json:"content"`
+	URL       string `json:"url,omitempty"`
+	FileType  string `json:"fileType,omitempty"`
+	FileName  string `json:"fileName,omitempty"`
+	FileSize  int64  `json:"fileSize,omitempty"`
+
+	// Client-generated ID; retrying with the same ID returns the original message
+	ClientMsgID string `json:"clientMsgId,omitempty" binding:"max=64"`
+
+	// UUID of the message being replied to, in the same conversation
+	ReplyToID string `json:"replyToId,omitempty"`
+
+	// Users mentioned in a group message, in addition to @<user ID> in the content
+	Mentions []string `json:"mentions,omitempty"`
 }
 
 // MessageResponse contains message data for API response
@@ -45,52 +68,89 @@ type MessageResponse struct {
 	FileSize   int64  `json:"fileSize,omitempty"`
 	Status     int8   `json:"status"`
 	CreatedAt  string `json:"createdAt"`
+
+	ClientMsgID string `json:"clientMsgId,omitempty"`
+	EditedAt    string `json:"editedAt,omitempty"`
+	Recalled    bool   `json:"recalled,omitempty"`
+	ExpiresAt   string `json:"expiresAt,omitempty"` // Removed for everyone at this time; see the message_expired event
+
+	ReplyToID string       `json:"replyToId,omitempty"`
+	ReplyTo   *reply.Quote `json:"replyTo,omitempty"` // Preview of the replied-to message
+
+	ThreadID string         `json:"threadId,omitempty"` // Root of the thread this reply belongs to
+	Thread   *ThreadSummary `json:"thread,omitempty"`   // Replies under this message, when it is a thread root
+
+	// Original message and author credited by a forward
+	ForwardedFromID   string `json:"forwardedFromId,omitempty"`
+	ForwardedFromUser string `json:"forwardedFromUser,omitempty"`
+	ForwardedFromName string `json:"forwardedFromName,omitempty"`
+
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+
+	Media *upload.MediaInfo `json:"media,omitempty"` // Dimensions, placeholder and thumbnail of an attached image
+
+	DurationMs int64 `json:"durationMs,omitempty"` // Voice message length
+	Waveform   []int `json:"waveform,omitempty"`
+
+	Mentions   []string `json:"mentions,omitempty"`
+	MentionAll bool     `json:"mentionAll,omitempty"`
+
+	LinkPreview *linkpreview.Preview `json:"linkPreview,omitempty"` // Filled in after sending; see the message_updated event
+}
+
+// HistoryQuery selects a page of conversation history. At most one of
+// Before, After and Around may be set, each holding a message UUID.
+type HistoryQuery struct {
+	Limit  int
+	Before string
+	After  string
+	Around string
 }
 
-// Create creates a new message
+// HistoryPage is a chronological page of messages and whether more exist on either side
+type HistoryPage struct {
+	Messages  []MessageResponse `json:"messages"`
+	HasBefore bool              `json:"hasBefore"`
+	HasAfter  bool              `json:"hasAfter"`
+}
+
+// Create sends a new message. It goes through the same checks, storage,
+// session updates and delivery as a message sent over WebSocket, and a
+// request repeating an earlier clientMsgId returns the stored message
+// instead of creating a duplicate. Rejections are *chat.SendError wrapping
+// the underlying permission, reply, mention or attachment error.
 func Create(userID, nickname, avatar string, req CreateRequest) (*MessageResponse, error) {
-	msg := model.Message{
-		UUID:       "M" + uuid.New().String()[:11],
-		SessionID:  req.SessionID,
-		Type:       req.Type,
-		Content:    req.Content,
-		URL:        req.URL,
-		SendID:     userID,
-		SendName:   nickname,
-		SendAvatar: avatar,
-		ReceiveID:  req.ReceiveID,
-		FileType:   req.FileType,
-		FileName:   req.FileName,
-		FileSize:   req.FileSize,
-		Status:     model.MessageStatusSent,
-		SentAt:     sql.NullTime{Time: time.Now(), Valid: true},
-	}
-
-	if err := database.DB.Create(&msg).Error; err != nil {
-		return nil, fmt.Errorf("failed to create message: %w", err)
-	}
-
-	// Update session last message
-	displayContent := req.Content
-	switch req.Type {
-	case model.MessageTypeVoice:
-		displayContent = "[Voice message]"
-	case model.MessageTypeFile:
-		displayContent = "[File: " + req.FileName + "]"
-	case model.MessageTypeImage:
-		displayContent = "[Image]"
-	case model.MessageTypeVideoCall:
-		displayContent = "[Video call]"
-	}
-	session.UpdateLastMessage(req.SessionID, displayContent)
-
-	return toMessageResponse(&msg), nil
-}
-
-// GetBySessionID returns all messages for a session by looking up the session's participants
-func GetBySessionID(sessionID string, limit, offset int) ([]MessageResponse, error) {
-	if limit <= 0 {
-		limit = 50
+	msg, err := chat.GetHub().Deliver(&chat.WSMessage{
+		Type:        int(req.Type),
+		Content:     req.Content,
+		URL:         req.URL,
+		SendID:      userID,
+		SendName:    nickname,
+		SendAvatar:  avatar,
+		ReceiveID:   req.ReceiveID,
+		SessionID:   req.SessionID,
+		FileType:    req.FileType,
+		FileName:    req.FileName,
+		FileSize:    req.FileSize,
+		ReplyToID:   req.ReplyToID,
+		Mentions:    req.Mentions,
+		ClientMsgID: req.ClientMsgID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withAttachments(toMessageResponse(msg)), nil
+}
+
+// GetBySessionID returns one page of a session's history in chronological
+// order. With no cursor it returns the newest messages; Before and After page
+// older or newer from a message, and Around centers the page on one.
+// Thread replies are left out; they are listed with their thread. Only the
+// session's owner may read it, and only while they can still see the
+// conversation, so a removed group member can't keep reading its history.
+func GetBySessionID(sessionID, userID string, q HistoryQuery) (*HistoryPage, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
 	}
 
 	// First, get the session to find the participants
@@ -98,37 +158,182 @@ func GetBySessionID(sessionID string, limit, offset int) ([]MessageResponse, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	if sess.SendID != userID {
+		return nil, session.ErrSessionNotFound
+	}
+	if err := permission.CanViewConversation(userID, sess.ReceiveID); err != nil {
+		return nil, err
+	}
 
-	// Query messages between the two participants (both directions)
-	var messages []model.Message
-	if err := database.DB.Where(
-		"(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)",
-		sess.SendID, sess.ReceiveID, sess.ReceiveID, sess.SendID,
-	).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&messages).Error; err != nil {
+	messages, page, err := loadPage(conversation.Timeline(sess.SendID, sess.ReceiveID, time.Now()), q, func(messageUUID string) (*model.Message, error) {
+		return cursorMessage(messageUUID, sess)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	result := make([]MessageResponse, 0, len(messages))
+	page.Messages = make([]MessageResponse, 0, len(messages))
 	for _, m := range messages {
-		result = append(result, *toMessageResponse(&m))
+		page.Messages = append(page.Messages, *toMessageResponse(&m))
+	}
+	attachQuotes(page.Messages)
+	attachMedia(page.Messages)
+	if err := attachReactions(page.Messages); err != nil {
+		log.Printf("Failed to load reactions: %v", err)
+	}
+	if err := attachThreads(page.Messages); err != nil {
+		log.Printf("Failed to load threads: %v", err)
+	}
+
+	return page, nil
+}
+
+// normalize applies the default and maximum page size and checks that at most one cursor is set
+func (q *HistoryQuery) normalize() error {
+	if q.Limit <= 0 {
+		q.Limit = defaultHistoryLimit
+	}
+	if q.Limit > maxHistoryLimit {
+		q.Limit = maxHistoryLimit
 	}
 
-	// Reverse to get chronological order
-	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
-		result[i], result[j] = result[j], result[i]
+	set := 0
+	for _, c := range []string{q.Before, q.After, q.Around} {
+		if c != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// loadPage loads one chronological page of the messages selected by scope.
+// anchorFor resolves the query's cursor, rejecting messages outside the scope.
+func loadPage(scope func(*gorm.DB) *gorm.DB, q HistoryQuery, anchorFor func(string) (*model.Message, error)) ([]model.Message, *HistoryPage, error) {
+	cursor := q.Before + q.After + q.Around
+
+	page := &HistoryPage{}
+	var messages []model.Message
+	switch {
+	case cursor != "":
+		anchor, err := anchorFor(cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if q.After == "" {
+			// Around gives half the page to older messages, the anchor and the rest to newer ones
+			olderLimit := q.Limit
+			if q.Around != "" {
+				olderLimit = q.Limit / 2
+			}
+			older, more, err := fetchHistory(scope, beforeScope(anchor), true, olderLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = reverseMessages(older)
+			page.HasBefore = more
+			page.HasAfter = true
+		}
+		if q.Around != "" {
+			messages = append(messages, *anchor)
+		}
+		if q.Before == "" {
+			newerLimit := q.Limit
+			if q.Around != "" {
+				newerLimit = q.Limit - len(messages)
+			}
+			newer, more, err := fetchHistory(scope, afterScope(anchor), false, newerLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = append(messages, newer...)
+			page.HasAfter = more
+			if q.After != "" {
+				page.HasBefore = true
+			}
+		}
+	default:
+		latest, more, err := fetchHistory(scope, nil, true, q.Limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = reverseMessages(latest)
+		page.HasBefore = more
 	}
 
-	return result, nil
+	return messages, page, nil
 }
 
-// GetByUUID retrieves a message by UUID
+// cursorMessage loads the message a cursor points at, which must belong to the session's conversation
+func cursorMessage(messageUUID string, sess *model.Session) (*model.Message, error) {
+	msg, err := GetByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.InConversation(msg, sess.SendID, sess.ReceiveID) || msg.ThreadID != "" {
+		return nil, ErrInvalidCursor
+	}
+	return msg, nil
+}
+
+// fetchHistory loads up to limit messages past a keyset, newest first when
+// desc is set, and reports whether more remain beyond them
+func fetchHistory(scope, keyset func(*gorm.DB) *gorm.DB, desc bool, limit int) ([]model.Message, bool, error) {
+	if limit <= 0 {
+		return nil, false, nil
+	}
+
+	order := "created_at ASC, id ASC"
+	if desc {
+		order = "created_at DESC, id DESC"
+	}
+
+	query := database.DB.Scopes(scope)
+	if keyset != nil {
+		query = query.Scopes(keyset)
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	var messages []model.Message
+	if err := query.Order(order).Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
+
+// beforeScope selects messages older than m, ordered by (created_at, id)
+func beforeScope(m *model.Message) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("created_at < ? OR (created_at = ? AND id < ?)", m.CreatedAt, m.CreatedAt, m.ID)
+	}
+}
+
+// afterScope selects messages newer than m, ordered by (created_at, id)
+func afterScope(m *model.Message) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("created_at > ? OR (created_at = ? AND id > ?)", m.CreatedAt, m.CreatedAt, m.ID)
+	}
+}
+
+func reverseMessages(messages []model.Message) []model.Message {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// GetByUUID retrieves a message by UUID. A message past its retention period
+// is not found, even before the sweeper deletes it.
 func GetByUUID(uuid string) (*model.Message, error) {
 	var msg model.Message
-	if err := database.DB.Where("uuid = ?", uuid).First(&msg).Error; err != nil {
+	if err := database.DB.Scopes(conversation.Unexpired(time.Now())).
+		Where("uuid = ?", uuid).First(&msg).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrMessageNotFound
 		}
@@ -137,43 +342,77 @@ func GetByUUID(uuid string) (*model.Message, error) {
 	return &msg, nil
 }
 
-// MarkAsRead marks a message as read
-func MarkAsRead(messageUUID string) error {
-	return database.DB.Model(&model.Message{}).
-		Where("uuid = ?", messageUUID).
-		Update("status", model.MessageStatusRead).Error
+// withAttachments attaches the replied-to preview and media metadata to a single message response
+func withAttachments(resp *MessageResponse) *MessageResponse {
+	list := []MessageResponse{*resp}
+	attachQuotes(list)
+	attachMedia(list)
+	return &list[0]
 }
 
-// MarkAllAsRead marks all messages in a session as read
-func MarkAllAsRead(sessionUUID, userID string) error {
-	// Get session
-	sess, err := session.GetByUUID(sessionUUID)
+// attachQuotes loads the replied-to previews for a page of messages in one query
+func attachQuotes(messages []MessageResponse) {
+	var ids []string
+	for _, m := range messages {
+		if m.ReplyToID != "" {
+			ids = append(ids, m.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	quotes, err := reply.LoadQuotes(ids)
 	if err != nil {
-		return err
+		log.Printf("Failed to load quoted messages: %v", err)
+		return
+	}
+	for i := range messages {
+		if messages[i].ReplyToID != "" {
+			messages[i].ReplyTo = quotes[messages[i].ReplyToID]
+		}
 	}
+}
 
-	// Mark messages sent to this user as read
-	database.DB.Model(&model.Message{}).
-		Where("session_id = ? AND receive_id = ? AND status < ?", sessionUUID, userID, model.MessageStatusRead).
-		Update("status", model.MessageStatusRead)
+// attachMedia loads image metadata for a page of messages in one query
+func attachMedia(messages []MessageResponse) {
+	var urls []string
+	for _, m := range messages {
+		if m.URL != "" {
+			urls = append(urls, m.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
 
-	// Clear unread count for the session
-	return session.ClearUnread(sess.UUID)
+	media := upload.LoadMedia(urls)
+	for i := range messages {
+		messages[i].Media = media[messages[i].URL]
+	}
 }
 
-// GetUnreadCount returns the count of unread messages for a user
-func GetUnreadCount(userID string) (int64, error) {
-	var count int64
-	if err := database.DB.Model(&model.Message{}).
-		Where("receive_id = ? AND status < ?", userID, model.MessageStatusRead).
-		Count(&count).Error; err != nil {
-		return 0, err
+// getByClientMsgID retrieves a sender's message by its client-generated ID
+func getByClientMsgID(sendID, clientMsgID string) (*model.Message, error) {
+	var msg model.Message
+	if err := database.DB.Where("send_id = ? AND client_msg_id = ?", sendID, clientMsgID).
+		First(&msg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
 	}
-	return count, nil
+	return &msg, nil
+}
+
+// GetUnreadCount returns the count of unread messages for a user across
+// direct and group conversations
+func GetUnreadCount(userID string) (int64, error) {
+	return session.GetTotalUnread(userID)
 }
 
 func toMessageResponse(m *model.Message) *MessageResponse {
-	return &MessageResponse{
+	resp := &MessageResponse{
 		UUID:       m.UUID,
 		SessionID:  m.SessionID,
 		Type:       m.Type,
@@ -189,4 +428,27 @@ func toMessageResponse(m *model.Message) *MessageResponse {
 		Status:     m.Status,
 		CreatedAt:  m.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
+	if m.ClientMsgID != nil {
+		resp.ClientMsgID = *m.ClientMsgID
+	}
+	if m.EditedAt.Valid {
+		resp.EditedAt = m.EditedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	if m.ExpiresAt.Valid {
+		resp.ExpiresAt = m.ExpiresAt.Time.Format("2006-01-02 15:04:05")
+	}
+	resp.Recalled = m.Recalled
+	resp.ReplyToID = m.ReplyToID
+	resp.ThreadID = m.ThreadID
+	resp.ForwardedFromID = m.ForwardedFromID
+	resp.ForwardedFromUser = m.ForwardedFromUser
+	resp.ForwardedFromName = m.ForwardedFromName
+	if m.DurationMs > 0 {
+		resp.DurationMs = m.DurationMs
+		resp.Waveform = media.DecodeWaveform(m.Waveform)
+	}
+	resp.Mentions = mention.Decode(m.Mentions)
+	resp.MentionAll = m.MentionAll
+	resp.LinkPreview = linkpreview.Decode(m.LinkPreview)
+	return resp
 }
@@ -0,0 +1,110 @@
+package message
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToMessageResponse_ClientMsgID(t *testing.T) {
+	id := "c-1"
+	resp := toMessageResponse(&model.Message{UUID: "M1", ClientMsgID: &id})
+	assert.Equal(t, "c-1", resp.ClientMsgID)
+
+	resp = toMessageResponse(&model.Message{UUID: "M2"})
+	assert.Empty(t, resp.ClientMsgID)
+}
+
+func TestWithinWindow(t *testing.T) {
+	sent := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, withinWindow(sent, 15*time.Minute, sent.Add(10*time.Minute)))
+	assert.True(t, withinWindow(sent, 15*time.Minute, sent.Add(15*time.Minute)))
+	assert.False(t, withinWindow(sent, 15*time.Minute, sent.Add(16*time.Minute)))
+
+	// No limit configured
+	assert.True(t, withinWindow(sent, 0, sent.Add(24*time.Hour)))
+}
+
+func TestToMessageResponse_EditedAndRecalled(t *testing.T) {
+	editedAt := time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)
+	resp := toMessageResponse(&model.Message{
+		UUID:     "M1",
+		Content:  "fixed typo",
+		EditedAt: sql.NullTime{Time: editedAt, Valid: true},
+	})
+	assert.Equal(t, "2024-01-01 12:05:00", resp.EditedAt)
+	assert.False(t, resp.Recalled)
+
+	resp = toMessageResponse(&model.Message{UUID: "M2", Recalled: true})
+	assert.True(t, resp.Recalled)
+	assert.Empty(t, resp.EditedAt)
+}
+
+func TestValidEmoji(t *testing.T) {
+	assert.True(t, validEmoji("👍"))
+	assert.True(t, validEmoji("👨‍👩‍👧"))
+	assert.True(t, validEmoji(":+1:"))
+
+	assert.False(t, validEmoji(""))
+	assert.False(t, validEmoji("thumbs up"))
+	assert.False(t, validEmoji("\n"))
+	assert.False(t, validEmoji(strings.Repeat("😀", 10)))
+}
+
+func TestSummarizeReactions(t *testing.T) {
+	summary := summarizeReactions([]model.Reaction{
+		{MessageID: "M1", UserID: "Ualice", Emoji: "👍"},
+		{MessageID: "M1", UserID: "Ubob", Emoji: "🎉"},
+		{MessageID: "M1", UserID: "Ubob", Emoji: "👍"},
+		{MessageID: "M2", UserID: "Ualice", Emoji: "❤️"},
+	})
+
+	assert.Equal(t, []ReactionSummary{
+		{Emoji: "👍", Count: 2, UserIDs: []string{"Ualice", "Ubob"}},
+		{Emoji: "🎉", Count: 1, UserIDs: []string{"Ubob"}},
+	}, summary["M1"])
+	assert.Equal(t, []ReactionSummary{
+		{Emoji: "❤️", Count: 1, UserIDs: []string{"Ualice"}},
+	}, summary["M2"])
+	assert.Empty(t, summary["M3"])
+}
+
+func TestGroupReadersScope(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var sessions []model.Session
+	stmt := db.Scopes(groupReadersScope("Ggroup", "Ualice", 42)).Find(&sessions).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "receive_id = $1 AND send_id <> $2 AND last_read_id >= $3")
+	assert.Equal(t, []interface{}{"Ggroup", "Ualice", int64(42)}, stmt.Vars)
+}
+
+func TestHistoryKeysetScopes(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	anchor := &model.Message{ID: 7, CreatedAt: at}
+
+	var messages []model.Message
+	stmt := db.Scopes(conversation.Messages("Ualice", "Ggroup"), beforeScope(anchor)).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "receive_id = $1 AND (created_at < $2 OR (created_at = $3 AND id < $4))")
+	assert.Equal(t, []interface{}{"Ggroup", at, at, int64(7)}, stmt.Vars)
+
+	stmt = testutil.DryRunDB(t).Scopes(afterScope(anchor)).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "created_at > $1 OR (created_at = $2 AND id > $3)")
+}
+
+func TestGetBySessionID_RejectsMultipleCursors(t *testing.T) {
+	_, err := GetBySessionID("S1", "Ualice", HistoryQuery{Before: "M1", Around: "M2"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestReverseMessages(t *testing.T) {
+	messages := reverseMessages([]model.Message{{ID: 1}, {ID: 2}, {ID: 3}})
+	assert.Equal(t, []int64{3, 2, 1}, []int64{messages[0].ID, messages[1].ID, messages[2].ID})
+}
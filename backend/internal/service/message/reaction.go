@@ -0,0 +1,177 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+)
+
+var (
+	ErrInvalidEmoji     = errors.New("invalid emoji")
+	ErrReactionExists   = errors.New("reaction already exists")
+	ErrReactionNotFound = errors.New("reaction not found")
+)
+
+// Longest accepted reaction, in bytes (covers multi-codepoint emoji sequences)
+const maxEmojiLen = 32
+
+// ReactionRequest contains the emoji to add to a message
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// ReactionSummary aggregates one emoji's reactions on a message
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"userIds"`
+}
+
+// AddReaction adds userID's emoji reaction to a message they can see
+func AddReaction(messageUUID, userID, emoji string) error {
+	msg, err := getReactableMessage(messageUUID, userID, emoji)
+	if err != nil {
+		return err
+	}
+
+	var existing model.Reaction
+	if err := database.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.UUID, userID, emoji).
+		First(&existing).Error; err == nil {
+		return ErrReactionExists
+	}
+
+	reaction := model.Reaction{MessageID: msg.UUID, UserID: userID, Emoji: emoji}
+	if err := database.DB.Create(&reaction).Error; err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	notifyReaction("reaction_added", msg, userID, emoji)
+	return nil
+}
+
+// RemoveReaction removes userID's emoji reaction from a message
+func RemoveReaction(messageUUID, userID, emoji string) error {
+	msg, err := getReactableMessage(messageUUID, userID, emoji)
+	if err != nil {
+		return err
+	}
+
+	result := database.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.UUID, userID, emoji).
+		Delete(&model.Reaction{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove reaction: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrReactionNotFound
+	}
+
+	notifyReaction("reaction_removed", msg, userID, emoji)
+	return nil
+}
+
+// getReactableMessage validates the emoji and loads a live message the user can see
+func getReactableMessage(messageUUID, userID, emoji string) (*model.Message, error) {
+	if !validEmoji(emoji) {
+		return nil, ErrInvalidEmoji
+	}
+
+	msg, err := GetByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	if err := permission.CanView(userID, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// validEmoji accepts a short, non-blank string without whitespace or control characters
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLen || !utf8.ValidString(emoji) {
+		return false
+	}
+	return strings.IndexFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0
+}
+
+// notifyReaction tells everyone in the message's conversation about a reaction change
+func notifyReaction(eventType string, msg *model.Message, userID, emoji string) {
+	chat.GetHub().SendToConversation(msg.SendID, msg.ReceiveID, chat.WSResponse{
+		Type: eventType,
+		Data: map[string]interface{}{
+			"messageId": msg.UUID,
+			"sendId":    msg.SendID,
+			"receiveId": msg.ReceiveID,
+			"userId":    userID,
+			"emoji":     emoji,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// loadReactions returns reaction summaries for the given message UUIDs, keyed by UUID
+func loadReactions(uuids []string) (map[string][]ReactionSummary, error) {
+	result := make(map[string][]ReactionSummary)
+	if len(uuids) == 0 {
+		return result, nil
+	}
+
+	var reactions []model.Reaction
+	if err := database.DB.Where("message_id IN ?", uuids).
+		Order("id ASC").
+		Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+
+	return summarizeReactions(reactions), nil
+}
+
+// summarizeReactions groups reactions by message then emoji, in order of first use
+func summarizeReactions(reactions []model.Reaction) map[string][]ReactionSummary {
+	result := make(map[string][]ReactionSummary)
+	index := make(map[string]map[string]int)
+
+	for _, r := range reactions {
+		if index[r.MessageID] == nil {
+			index[r.MessageID] = make(map[string]int)
+		}
+		i, ok := index[r.MessageID][r.Emoji]
+		if !ok {
+			i = len(result[r.MessageID])
+			index[r.MessageID][r.Emoji] = i
+			result[r.MessageID] = append(result[r.MessageID], ReactionSummary{Emoji: r.Emoji})
+		}
+		result[r.MessageID][i].Count++
+		result[r.MessageID][i].UserIDs = append(result[r.MessageID][i].UserIDs, r.UserID)
+	}
+	return result
+}
+
+// attachReactions loads reaction summaries for a page of messages in one query
+func attachReactions(messages []MessageResponse) error {
+	uuids := make([]string, len(messages))
+	for i, m := range messages {
+		uuids[i] = m.UUID
+	}
+
+	reactions, err := loadReactions(uuids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].UUID]
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotMessageRecipient = errors.New("not message recipient")
+)
+
+// ReceiptResponse lists who has read a message
+type ReceiptResponse struct {
+	UUID   string   `json:"uuid"`
+	Status int8     `json:"status"`
+	ReadBy []string `json:"readBy"`
+}
+
+// MarkAsRead marks a message userID received as read and tells the sender.
+// In groups it advances the member's read position instead, since the
+// message row is shared by every member.
+func MarkAsRead(messageUUID, userID string) error {
+	msg, err := GetByUUID(messageUUID)
+	if err != nil {
+		return err
+	}
+
+	if session.IsGroupID(msg.ReceiveID) {
+		if err := permission.CanView(userID, msg); err != nil {
+			return err
+		}
+		if msg.SendID == userID {
+			return nil
+		}
+
+		var sess model.Session
+		if err := database.DB.Where("send_id = ? AND receive_id = ?", userID, msg.ReceiveID).
+			First(&sess).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return session.ErrSessionNotFound
+			}
+			return err
+		}
+		return advanceReadPosition(&sess, msg.ID, msg.UUID)
+	}
+
+	if msg.ReceiveID != userID {
+		return ErrNotMessageRecipient
+	}
+
+	result := database.DB.Model(&model.Message{}).
+		Where("id = ? AND status < ?", msg.ID, model.MessageStatusRead).
+		Update("status", model.MessageStatusRead)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark message as read: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		notifyDirectRead(msg.SendID, userID, []string{msg.UUID})
+	}
+	return nil
+}
+
+// MarkAllAsRead marks all messages in a session as read and tells their senders
+func MarkAllAsRead(sessionUUID, userID string) error {
+	// Get session
+	sess, err := session.GetByUUID(sessionUUID)
+	if err != nil {
+		return err
+	}
+	if sess.SendID != userID {
+		return session.ErrSessionNotFound
+	}
+
+	if session.IsGroupID(sess.ReceiveID) {
+		var latest model.Message
+		err := database.DB.Where("receive_id = ?", sess.ReceiveID).
+			Order("id DESC").
+			Select("id", "uuid").
+			First(&latest).Error
+		if err == nil {
+			if err := advanceReadPosition(sess, latest.ID, latest.UUID); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return session.ClearUnread(sess.UUID)
+	}
+
+	// Mark messages sent to this user as read
+	var uuids []string
+	if err := database.DB.Model(&model.Message{}).
+		Where("send_id = ? AND receive_id = ? AND status < ?", sess.ReceiveID, userID, model.MessageStatusRead).
+		Pluck("uuid", &uuids).Error; err != nil {
+		return fmt.Errorf("failed to get unread messages: %w", err)
+	}
+	if len(uuids) > 0 {
+		if err := database.DB.Model(&model.Message{}).
+			Where("uuid IN ?", uuids).
+			Update("status", model.MessageStatusRead).Error; err != nil {
+			return fmt.Errorf("failed to mark messages as read: %w", err)
+		}
+		notifyDirectRead(sess.ReceiveID, userID, uuids)
+	}
+
+	// Clear unread count for the session
+	return session.ClearUnread(sess.UUID)
+}
+
+// GetReadReceipts tells the sender of a message who has read it
+func GetReadReceipts(messageUUID, userID string) (*ReceiptResponse, error) {
+	msg, err := GetByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SendID != userID {
+		return nil, ErrNotMessageSender
+	}
+
+	resp := &ReceiptResponse{UUID: msg.UUID, Status: msg.Status, ReadBy: []string{}}
+	if !session.IsGroupID(msg.ReceiveID) {
+		if msg.Status == model.MessageStatusRead {
+			resp.ReadBy = append(resp.ReadBy, msg.ReceiveID)
+		}
+		return resp, nil
+	}
+
+	if err := database.DB.Model(&model.Session{}).
+		Scopes(groupReadersScope(msg.ReceiveID, msg.SendID, msg.ID)).
+		Pluck("send_id", &resp.ReadBy).Error; err != nil {
+		return nil, fmt.Errorf("failed to get read receipts: %w", err)
+	}
+	return resp, nil
+}
+
+// groupReadersScope selects the group sessions of members, other than the
+// sender, whose read position has reached messageID
+func groupReadersScope(groupUUID, senderID string, messageID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("receive_id = ? AND send_id <> ? AND last_read_id >= ?", groupUUID, senderID, messageID)
+	}
+}
+
+// advanceReadPosition moves a member's group read position forward to
+// messageID and tells the senders of the newly read messages
+func advanceReadPosition(sess *model.Session, messageID int64, messageUUID string) error {
+	result := database.DB.Model(&model.Session{}).
+		Where("id = ? AND last_read_id < ?", sess.ID, messageID).
+		Update("last_read_id", messageID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update read position: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	var senders []string
+	if err := database.DB.Model(&model.Message{}).
+		Where("receive_id = ? AND id > ? AND id <= ? AND send_id <> ?", sess.ReceiveID, sess.LastReadID, messageID, sess.SendID).
+		Distinct().
+		Pluck("send_id", &senders).Error; err != nil {
+		return fmt.Errorf("failed to get message senders: %w", err)
+	}
+	sess.LastReadID = messageID
+
+	chat.GetHub().SendToUsers(senders, chat.WSResponse{
+		Type: "message_read",
+		Data: map[string]interface{}{
+			"receiveId":  sess.ReceiveID,
+			"userId":     sess.SendID,
+			"lastReadId": messageUUID,
+			"readAt":     time.Now().Format("2006-01-02 15:04:05"),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+	return nil
+}
+
+// notifyDirectRead tells the sender of direct messages that the reader has read them
+func notifyDirectRead(senderID, readerID string, uuids []string) {
+	chat.GetHub().SendToUser(senderID, chat.WSResponse{
+		Type: "message_read",
+		Data: map[string]interface{}{
+			"receiveId":  readerID,
+			"userId":     readerID,
+			"messageIds": uuids,
+			"readAt":     time.Now().Format("2006-01-02 15:04:05"),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
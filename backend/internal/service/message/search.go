@@ -0,0 +1,275 @@
+package message
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmptySearchQuery = errors.New("search query is empty")
+)
+
+const (
+	// Search page sizes
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+
+	// Longest accepted search query, in runes
+	maxSearchQueryLen = 100
+
+	// Length of a result snippet, in runes
+	snippetLen = 80
+)
+
+// SearchQuery filters a search over the caller's conversations. Cursor is
+// the UUID of the last hit of the previous page.
+type SearchQuery struct {
+	Query     string
+	SenderID  string
+	ReceiveID string // Peer user or group UUID
+	Type      *int8
+	From      time.Time
+	To        time.Time // Exclusive
+	Limit     int
+	Cursor    string
+}
+
+// Highlight marks a matched term within a snippet, in characters
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SearchHit is one matching message with a snippet around the match
+type SearchHit struct {
+	Message    MessageResponse `json:"message"`
+	Snippet    string          `json:"snippet"`
+	Highlights []Highlight     `json:"highlights"`
+}
+
+// SearchResult is one page of hits, newest first
+type SearchResult struct {
+	Hits       []SearchHit `json:"hits"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	HasMore    bool        `json:"hasMore"`
+}
+
+// Search finds messages matching a text query in conversations userID takes part in
+func Search(userID string, q SearchQuery) (*SearchResult, error) {
+	q.Query = strings.TrimSpace(q.Query)
+	if q.Query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if runes := []rune(q.Query); len(runes) > maxSearchQueryLen {
+		q.Query = string(runes[:maxSearchQueryLen])
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchLimit
+	}
+	if q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+
+	match := textMatchScope(database.DB.Dialector.Name(), q.Query)
+	if match == nil {
+		return nil, ErrEmptySearchQuery
+	}
+
+	query := database.DB.Scopes(participantScope(userID), conversation.Unexpired(time.Now()), match, searchFilterScope(userID, q))
+	if q.Cursor != "" {
+		anchor, err := GetByUUID(q.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		query = query.Scopes(beforeScope(anchor))
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	var messages []model.Message
+	if err := query.Order("created_at DESC, id DESC").Limit(q.Limit + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	result := &SearchResult{Hits: make([]SearchHit, 0, len(messages))}
+	if len(messages) > q.Limit {
+		messages = messages[:q.Limit]
+		result.HasMore = true
+	}
+
+	responses := make([]MessageResponse, len(messages))
+	for i := range messages {
+		responses[i] = *toMessageResponse(&messages[i])
+	}
+	attachQuotes(responses)
+	attachMedia(responses)
+
+	terms := strings.Fields(q.Query)
+	for i, m := range messages {
+		text := m.Content
+		if !containsAny(text, terms) && m.FileName != "" {
+			text = m.FileName
+		}
+		snippet, highlights := highlight(text, terms, snippetLen)
+		result.Hits = append(result.Hits, SearchHit{Message: responses[i], Snippet: snippet, Highlights: highlights})
+	}
+	if result.HasMore {
+		result.NextCursor = messages[len(messages)-1].UUID
+	}
+
+	return result, nil
+}
+
+// participantScope limits messages to the user's direct conversations and
+// the groups they currently belong to
+func participantScope(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		groups := db.Session(&gorm.Session{NewDB: true}).
+			Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+		return db.Where("send_id = ? OR receive_id = ? OR receive_id IN (?)", userID, userID, groups).
+			Where("recalled = ?", false)
+	}
+}
+
+// textMatchScope matches the query against the dialect's full-text index,
+// or returns nil when nothing searchable is left
+func textMatchScope(dialect, query string) func(*gorm.DB) *gorm.DB {
+	if dialect == "mysql" {
+		boolean := mysqlBooleanQuery(query)
+		if boolean == "" {
+			return nil
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("MATCH("+database.MessageSearchColumns+") AGAINST (? IN BOOLEAN MODE)", boolean)
+		}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(database.MessageSearchVector+" @@ plainto_tsquery('simple', ?)", query)
+	}
+}
+
+// mysqlBooleanQuery requires every word as a prefix match, dropping the
+// characters boolean mode treats as operators
+func mysqlBooleanQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-<>()~*"@`, r) {
+				return -1
+			}
+			return r
+		}, word)
+		if word != "" {
+			terms = append(terms, "+"+word+"*")
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchFilterScope applies the optional sender, conversation, type and date
+// filters. The conversation is userID's direct chat with ReceiveID, or the
+// group ReceiveID.
+func searchFilterScope(userID string, q SearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if q.SenderID != "" {
+			db = db.Where("send_id = ?", q.SenderID)
+		}
+		if q.ReceiveID != "" {
+			db = conversation.Messages(userID, q.ReceiveID)(db)
+		}
+		if q.Type != nil {
+			db = db.Where("type = ?", *q.Type)
+		}
+		if !q.From.IsZero() {
+			db = db.Where("created_at >= ?", q.From)
+		}
+		if !q.To.IsZero() {
+			db = db.Where("created_at < ?", q.To)
+		}
+		return db
+	}
+}
+
+// highlight cuts a snippet of about width characters around the first
+// matched term and marks every term occurrence within it
+func highlight(text string, terms []string, width int) (string, []Highlight) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	lowerTerms := make([][]rune, 0, len(terms))
+	for _, t := range terms {
+		if t = strings.ToLower(t); t != "" {
+			lowerTerms = append(lowerTerms, []rune(t))
+		}
+	}
+
+	first := -1
+	for i := range lower {
+		if matchAt(lower, i, lowerTerms) > 0 {
+			first = i
+			break
+		}
+	}
+
+	start := 0
+	if first > width/4 {
+		start = first - width/4
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	offset := len([]rune(prefix)) - start
+
+	highlights := []Highlight{}
+	for i := start; i < end; {
+		n := matchAt(lower, i, lowerTerms)
+		if n == 0 || i+n > end {
+			i++
+			continue
+		}
+		highlights = append(highlights, Highlight{Start: i + offset, End: i + n + offset})
+		i += n
+	}
+
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// matchAt returns the length of the longest term found at position i, or 0
+func matchAt(text []rune, i int, terms [][]rune) int {
+	longest := 0
+	for _, t := range terms {
+		if len(t) > longest && i+len(t) <= len(text) && string(text[i:i+len(t)]) == string(t) {
+			longest = len(t)
+		}
+	}
+	return longest
+}
+
+// containsAny reports whether text contains any term, ignoring case
+func containsAny(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, t := range terms {
+		if strings.Contains(text, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlBooleanQuery(t *testing.T) {
+	assert.Equal(t, "+hello* +world*", mysqlBooleanQuery("hello  world"))
+	assert.Equal(t, "+drop*", mysqlBooleanQuery(`-"drop" (*)`))
+	assert.Empty(t, mysqlBooleanQuery("+ - ~"))
+}
+
+func TestTextMatchScope(t *testing.T) {
+	var messages []model.Message
+
+	stmt := testutil.DryRunDB(t).Scopes(textMatchScope("postgres", "hello")).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "@@ plainto_tsquery('simple', $1)")
+
+	stmt = testutil.DryRunDB(t).Scopes(textMatchScope("mysql", "hello")).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "MATCH(content, file_name) AGAINST ($1 IN BOOLEAN MODE)")
+	assert.Equal(t, []interface{}{"+hello*"}, stmt.Vars)
+
+	assert.Nil(t, textMatchScope("mysql", "()"))
+}
+
+func TestParticipantScope(t *testing.T) {
+	var messages []model.Message
+	stmt := testutil.DryRunDB(t).Scopes(participantScope("Ualice")).Find(&messages).Statement
+
+	sql := stmt.SQL.String()
+	assert.Contains(t, sql, "send_id = $1 OR receive_id = $2 OR receive_id IN (SELECT \"group_id\" FROM \"group_members\" WHERE user_id = $3)")
+	assert.Contains(t, sql, "recalled = ")
+}
+
+func TestSearchFilterScope_Conversation(t *testing.T) {
+	var messages []model.Message
+
+	// A peer filter selects the direct chat, not the peer's messages elsewhere
+	stmt := testutil.DryRunDB(t).Scopes(searchFilterScope("Ualice", SearchQuery{ReceiveID: "Ubob"})).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "(send_id = $1 AND receive_id = $2) OR (send_id = $3 AND receive_id = $4)")
+	assert.Equal(t, []interface{}{"Ualice", "Ubob", "Ubob", "Ualice"}, stmt.Vars)
+
+	stmt = testutil.DryRunDB(t).Scopes(searchFilterScope("Ualice", SearchQuery{ReceiveID: "Ggroup"})).Find(&messages).Statement
+	assert.Contains(t, stmt.SQL.String(), "WHERE receive_id = $1")
+	assert.NotContains(t, stmt.SQL.String(), "send_id")
+}
+
+func TestHighlight(t *testing.T) {
+	snippet, highlights := highlight("Meeting moved to Friday, see you at the meeting", []string{"meeting"}, 80)
+	assert.Equal(t, "Meeting moved to Friday, see you at the meeting", snippet)
+	assert.Equal(t, []Highlight{{Start: 0, End: 7}, {Start: 40, End: 47}}, highlights)
+
+	// Long text is cut around the first match
+	long := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa needle bbbbbbbbbbbbbbbbbbbb"
+	snippet, highlights = highlight(long, []string{"needle"}, 20)
+	assert.Equal(t, "…aaaa needle bbbbbbbb…", snippet)
+	assert.Equal(t, []Highlight{{Start: 6, End: 12}}, highlights)
+}
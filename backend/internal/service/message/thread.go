@@ -0,0 +1,286 @@
+package message
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotThreadable = errors.New("only group messages can have threads")
+	ErrNestedThread  = errors.New("thread replies cannot start threads")
+)
+
+// ThreadSummary is the reply count and latest reply shown on a thread root
+type ThreadSummary struct {
+	ReplyCount    int    `json:"replyCount"`
+	LastReplyID   string `json:"lastReplyId,omitempty"`
+	LastReplyBy   string `json:"lastReplyBy,omitempty"`
+	LastReplyName string `json:"lastReplyName,omitempty"`
+	LastReplyAt   string `json:"lastReplyAt,omitempty"`
+}
+
+// ThreadReplyRequest contains a reply posted inside a thread
+type ThreadReplyRequest struct {
+	Type    int8   `json:"type"` // 0: text, 1: voice, 2: file, 3: image
+	Content string `json:"content"`
+	URL     string `json:"url,omitempty"`
+
+	// Client-generated ID; retrying with the same ID returns the original reply
+	ClientMsgID string `json:"clientMsgId,omitempty" binding:"max=64"`
+
+	// Users mentioned in the reply, in addition to @<user ID> in the content
+	Mentions []string `json:"mentions,omitempty"`
+}
+
+// ThreadPage is a thread's root and one chronological page of its replies
+type ThreadPage struct {
+	Root      MessageResponse   `json:"root"`
+	Replies   []MessageResponse `json:"replies"`
+	HasBefore bool              `json:"hasBefore"`
+	HasAfter  bool              `json:"hasAfter"`
+	Following bool              `json:"following"`
+}
+
+// ReplyInThread posts a reply in the thread under a group message, making it a
+// thread root on the first reply. The reply goes through the same checks and
+// storage as any other message, stays out of the main timeline and is sent
+// only to the thread's followers who are still in the group. The root's
+// author, every replier and every user mentioned by name follow the thread
+// automatically.
+func ReplyInThread(userID, nickname, avatar, rootUUID string, req ThreadReplyRequest) (*MessageResponse, error) {
+	root, err := getThreadRoot(rootUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if root.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	if req.URL == "" && req.Content == "" {
+		return nil, ErrEmptyMessageContent
+	}
+
+	msg, duplicate, err := chat.GetHub().SaveThreadReply(&chat.WSMessage{
+		Type:        int(req.Type),
+		Content:     req.Content,
+		URL:         req.URL,
+		SendID:      userID,
+		SendName:    nickname,
+		SendAvatar:  avatar,
+		ReceiveID:   root.ReceiveID,
+		Mentions:    req.Mentions,
+		ClientMsgID: req.ClientMsgID,
+	}, root.UUID)
+	if err != nil {
+		return nil, err
+	}
+	// A retried send was already delivered the first time
+	if duplicate {
+		return withAttachments(toMessageResponse(msg)), nil
+	}
+
+	thread, err := recordThreadReply(root, msg)
+	if err != nil {
+		return nil, err
+	}
+	followerIDs := append([]string{userID}, mention.Decode(msg.Mentions)...)
+	if root.SendID != userID && permission.CanViewConversation(root.SendID, root.ReceiveID) == nil {
+		// The root's author follows only while still in the group
+		followerIDs = append(followerIDs, root.SendID)
+	}
+	for _, followerID := range followerIDs {
+		if err := follow(root.UUID, followerID); err != nil {
+			log.Printf("Failed to follow thread %s: %v", root.UUID, err)
+		}
+	}
+
+	var followers []string
+	if err := database.DB.Model(&model.ThreadFollower{}).
+		Where("root_id = ?", root.UUID).
+		Pluck("user_id", &followers).Error; err != nil {
+		log.Printf("Failed to get thread followers: %v", err)
+	}
+	chat.GetHub().NotifyThreadReply(msg, followers, thread.ReplyCount)
+
+	return withAttachments(toMessageResponse(msg)), nil
+}
+
+// GetThread returns a thread's root and one page of its replies, paged like
+// conversation history
+func GetThread(rootUUID, userID string, q HistoryQuery) (*ThreadPage, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+
+	root, err := getThreadRoot(rootUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, page, err := loadPage(threadScope(root.UUID), q, func(messageUUID string) (*model.Message, error) {
+		msg, err := GetByUUID(messageUUID)
+		if err != nil {
+			return nil, err
+		}
+		if msg.ThreadID != root.UUID {
+			return nil, ErrInvalidCursor
+		}
+		return msg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ThreadPage{
+		Root:      *withAttachments(toMessageResponse(root)),
+		Replies:   make([]MessageResponse, 0, len(messages)),
+		HasBefore: page.HasBefore,
+		HasAfter:  page.HasAfter,
+	}
+	for _, m := range messages {
+		result.Replies = append(result.Replies, *toMessageResponse(&m))
+	}
+	attachMedia(result.Replies)
+	if err := attachReactions(result.Replies); err != nil {
+		log.Printf("Failed to load reactions: %v", err)
+	}
+
+	roots := []MessageResponse{result.Root}
+	if err := attachThreads(roots); err != nil {
+		log.Printf("Failed to load thread: %v", err)
+	}
+	result.Root = roots[0]
+
+	var following int64
+	if err := database.DB.Model(&model.ThreadFollower{}).
+		Where("root_id = ? AND user_id = ?", root.UUID, userID).
+		Count(&following).Error; err != nil {
+		return nil, err
+	}
+	result.Following = following > 0
+
+	return result, nil
+}
+
+// FollowThread subscribes userID to new replies in a thread
+func FollowThread(rootUUID, userID string) error {
+	if _, err := getThreadRoot(rootUUID, userID); err != nil {
+		return err
+	}
+	return follow(rootUUID, userID)
+}
+
+// UnfollowThread stops sending userID new replies in a thread
+func UnfollowThread(rootUUID, userID string) error {
+	if _, err := getThreadRoot(rootUUID, userID); err != nil {
+		return err
+	}
+	return database.DB.Where("root_id = ? AND user_id = ?", rootUUID, userID).
+		Delete(&model.ThreadFollower{}).Error
+}
+
+// getThreadRoot loads a group message that can hold a thread and that userID can see
+func getThreadRoot(rootUUID, userID string) (*model.Message, error) {
+	root, err := GetByUUID(rootUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsGroupID(root.ReceiveID) {
+		return nil, ErrNotThreadable
+	}
+	if root.ThreadID != "" {
+		return nil, ErrNestedThread
+	}
+	if err := permission.CanView(userID, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// recordThreadReply counts a new reply on its thread, creating the thread on the first one
+func recordThreadReply(root, reply *model.Message) (*model.Thread, error) {
+	var thread model.Thread
+	if err := database.DB.Where(model.Thread{RootID: root.UUID}).
+		Attrs(model.Thread{GroupID: root.ReceiveID}).
+		FirstOrCreate(&thread).Error; err != nil {
+		return nil, fmt.Errorf("failed to create thread: %w", err)
+	}
+
+	if err := database.DB.Model(&model.Thread{}).Where("id = ?", thread.ID).Updates(map[string]interface{}{
+		"reply_count":     gorm.Expr("reply_count + 1"),
+		"last_reply_id":   reply.UUID,
+		"last_reply_by":   reply.SendID,
+		"last_reply_name": reply.SendName,
+		"last_reply_at":   sql.NullTime{Time: reply.CreatedAt, Valid: true},
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update thread: %w", err)
+	}
+
+	if err := database.DB.First(&thread, thread.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	return &thread, nil
+}
+
+// follow adds userID to a thread's followers unless they already follow it
+func follow(rootUUID, userID string) error {
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.ThreadFollower{RootID: rootUUID, UserID: userID}).Error
+}
+
+// threadScope selects the unexpired replies in a thread
+func threadScope(rootUUID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return conversation.Unexpired(time.Now())(db.Where("thread_id = ?", rootUUID))
+	}
+}
+
+// attachThreads loads thread summaries for a page of messages in one query
+func attachThreads(messages []MessageResponse) error {
+	uuids := make([]string, len(messages))
+	for i, m := range messages {
+		uuids[i] = m.UUID
+	}
+	if len(uuids) == 0 {
+		return nil
+	}
+
+	var threads []model.Thread
+	if err := database.DB.Where("root_id IN ?", uuids).Find(&threads).Error; err != nil {
+		return err
+	}
+
+	summaries := make(map[string]*ThreadSummary, len(threads))
+	for i := range threads {
+		summaries[threads[i].RootID] = toThreadSummary(&threads[i])
+	}
+	for i := range messages {
+		messages[i].Thread = summaries[messages[i].UUID]
+	}
+	return nil
+}
+
+func toThreadSummary(t *model.Thread) *ThreadSummary {
+	summary := &ThreadSummary{
+		ReplyCount:    t.ReplyCount,
+		LastReplyID:   t.LastReplyID,
+		LastReplyBy:   t.LastReplyBy,
+		LastReplyName: t.LastReplyName,
+	}
+	if t.LastReplyAt.Valid {
+		summary.LastReplyAt = t.LastReplyAt.Time.Format("2006-01-02 15:04:05")
+	}
+	return summary
+}
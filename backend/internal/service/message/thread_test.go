@@ -0,0 +1,53 @@
+package message
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadScope(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var messages []model.Message
+	stmt := db.Scopes(threadScope("Mroot"), beforeScope(&model.Message{ID: 3})).Find(&messages).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "thread_id = $1 AND (expires_at IS NULL OR expires_at > $2) AND (created_at < $3")
+	assert.Equal(t, "Mroot", stmt.Vars[0])
+}
+
+func TestHistoryQueryNormalize(t *testing.T) {
+	q := HistoryQuery{Limit: 1000}
+	assert.NoError(t, q.normalize())
+	assert.Equal(t, maxHistoryLimit, q.Limit)
+
+	q = HistoryQuery{}
+	assert.NoError(t, q.normalize())
+	assert.Equal(t, defaultHistoryLimit, q.Limit)
+
+	q = HistoryQuery{Before: "M1", After: "M2"}
+	assert.ErrorIs(t, q.normalize(), ErrInvalidCursor)
+}
+
+func TestToThreadSummary(t *testing.T) {
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	summary := toThreadSummary(&model.Thread{
+		ReplyCount:    3,
+		LastReplyID:   "M9",
+		LastReplyBy:   "Ubob",
+		LastReplyName: "Bob",
+		LastReplyAt:   sql.NullTime{Time: at, Valid: true},
+	})
+
+	assert.Equal(t, &ThreadSummary{
+		ReplyCount:    3,
+		LastReplyID:   "M9",
+		LastReplyBy:   "Ubob",
+		LastReplyName: "Bob",
+		LastReplyAt:   "2025-03-04 05:06:07",
+	}, summary)
+	assert.Empty(t, toThreadSummary(&model.Thread{}).LastReplyAt)
+}
@@ -0,0 +1,228 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+// Error is a permission failure with a machine-readable code for clients
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrReceiverNotFound = &Error{Code: "receiver_not_found", Message: "receiver not found"}
+	ErrNotFriends       = &Error{Code: "not_friends", Message: "you can only message your contacts"}
+	ErrBlocked          = &Error{Code: "blocked", Message: "you have been blocked by this user"}
+	ErrYouBlocked       = &Error{Code: "you_blocked", Message: "unblock this user to send messages"}
+	ErrGroupNotFound    = &Error{Code: "group_not_found", Message: "group not found"}
+	ErrGroupDissolved   = &Error{Code: "group_dissolved", Message: "group has been dissolved"}
+	ErrGroupDisabled    = &Error{Code: "group_disabled", Message: "group has been disabled"}
+	ErrNotGroupMember   = &Error{Code: "not_group_member", Message: "you are not a member of this group"}
+	ErrKickedFromGroup  = &Error{Code: "kicked_from_group", Message: "you have been removed from this group"}
+	ErrSessionMismatch  = &Error{Code: "session_mismatch", Message: "session does not belong to this conversation"}
+	ErrNotParticipant   = &Error{Code: "not_participant", Message: "you are not part of this conversation"}
+)
+
+// AsError returns the permission error wrapped in err, if any
+func AsError(err error) (*Error, bool) {
+	var permErr *Error
+	if errors.As(err, &permErr) {
+		return permErr, true
+	}
+	return nil, false
+}
+
+// CanSend checks whether a user may send a message to a user or group,
+// optionally through one of their own sessions. It is the single check used by
+// both the WebSocket and REST send paths. A nil error means the send is allowed.
+func CanSend(senderID, receiveID, sessionID string) error {
+	if sessionID != "" {
+		if err := checkSession(senderID, receiveID, sessionID); err != nil {
+			return err
+		}
+	}
+
+	if session.IsGroupID(receiveID) {
+		return checkGroup(senderID, receiveID)
+	}
+	return checkDirect(senderID, receiveID)
+}
+
+// CanView checks whether a user may see a message and act on it (react, quote,
+// forward, download its media): they must be one of the two users of a direct
+// chat, or a current member of an active group.
+func CanView(userID string, msg *model.Message) error {
+	if session.IsGroupID(msg.ReceiveID) {
+		return checkGroup(userID, msg.ReceiveID)
+	}
+	if msg.SendID != userID && msg.ReceiveID != userID {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+// CanViewConversation checks whether a user may see a conversation's shared
+// state, such as its pinned messages: a direct chat is always visible to the
+// user themselves, a group only to its current members.
+func CanViewConversation(userID, receiveID string) error {
+	if session.IsGroupID(receiveID) {
+		return checkGroup(userID, receiveID)
+	}
+	return nil
+}
+
+// GroupRole returns a user's role in a group. The owner is recorded on the
+// group itself; everyone else's role is on their group_members row. A user
+// with no row is reported as a plain member, so callers that need membership
+// must check it separately.
+func GroupRole(group *model.Group, userID string) (int8, error) {
+	if group.OwnerID == userID {
+		return model.GroupRoleOwner, nil
+	}
+
+	var member model.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", group.UUID, userID).
+		Select("role").First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.GroupRoleMember, nil
+		}
+		return 0, fmt.Errorf("failed to get group role: %w", err)
+	}
+	return member.Role, nil
+}
+
+// IsGroupManager reports whether a role may moderate a group: edit its info,
+// remove members, pin messages and mention everyone
+func IsGroupManager(role int8) bool {
+	return role >= model.GroupRoleAdmin
+}
+
+// checkSession verifies the session is the sender's own view of this conversation
+func checkSession(senderID, receiveID, sessionID string) error {
+	sess, err := session.GetByUUID(sessionID)
+	if err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return ErrSessionMismatch
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess.SendID != senderID || sess.ReceiveID != receiveID {
+		return ErrSessionMismatch
+	}
+	return nil
+}
+
+// checkDirect verifies both users are contacts and neither has blocked the other
+func checkDirect(senderID, receiveID string) error {
+	var receiver model.User
+	if err := database.DB.Where("uuid = ?", receiveID).Select("uuid").First(&receiver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReceiverNotFound
+		}
+		return fmt.Errorf("failed to get receiver: %w", err)
+	}
+
+	senderContact, err := findContact(senderID, receiveID, model.ContactTypeUser)
+	if err != nil {
+		return err
+	}
+	receiverContact, err := findContact(receiveID, senderID, model.ContactTypeUser)
+	if err != nil {
+		return err
+	}
+
+	return directError(senderContact, receiverContact)
+}
+
+// directError decides a direct send from each side's contact row (nil when absent)
+func directError(senderContact, receiverContact *model.Contact) error {
+	if receiverContact != nil && receiverContact.Status == model.ContactStatusBlacklisted {
+		return ErrBlocked
+	}
+	if senderContact == nil {
+		return ErrNotFriends
+	}
+
+	switch senderContact.Status {
+	case model.ContactStatusNormal, model.ContactStatusMuted:
+		return nil
+	case model.ContactStatusBlacklisted:
+		return ErrYouBlocked
+	default:
+		return ErrNotFriends
+	}
+}
+
+// checkGroup verifies the group is active and the sender is a current member
+func checkGroup(senderID, groupUUID string) error {
+	var group model.Group
+	if err := database.DB.Where("uuid = ?", groupUUID).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+
+	var memberships int64
+	if err := database.DB.Model(&model.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupUUID, senderID).
+		Count(&memberships).Error; err != nil {
+		return fmt.Errorf("failed to get group membership: %w", err)
+	}
+	isMember := memberships > 0
+
+	var contact *model.Contact
+	if !isMember {
+		var err error
+		if contact, err = findContact(senderID, groupUUID, model.ContactTypeGroup); err != nil {
+			return err
+		}
+	}
+
+	return groupError(&group, isMember, contact)
+}
+
+// groupError decides a group send from the group's state and the sender's
+// membership; contact explains why a non-member can no longer post
+func groupError(group *model.Group, isMember bool, contact *model.Contact) error {
+	switch group.Status {
+	case model.GroupStatusDissolved:
+		return ErrGroupDissolved
+	case model.GroupStatusDisabled:
+		return ErrGroupDisabled
+	}
+
+	if isMember {
+		return nil
+	}
+	if contact != nil && contact.Status == model.ContactStatusKicked {
+		return ErrKickedFromGroup
+	}
+	return ErrNotGroupMember
+}
+
+// findContact returns the most recent contact row from userID to contactID, or nil
+func findContact(userID, contactID string, contactType int8) (*model.Contact, error) {
+	var contact model.Contact
+	err := database.DB.Where("user_id = ? AND contact_id = ? AND contact_type = ?", userID, contactID, contactType).
+		Order("id DESC").
+		First(&contact).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+	return &contact, nil
+}
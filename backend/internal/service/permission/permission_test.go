@@ -0,0 +1,77 @@
+package permission
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func contactWithStatus(status int8) *model.Contact {
+	return &model.Contact{Status: status}
+}
+
+func TestDirectError(t *testing.T) {
+	tests := []struct {
+		name     string
+		sender   *model.Contact
+		receiver *model.Contact
+		want     error
+	}{
+		{"friends", contactWithStatus(model.ContactStatusNormal), contactWithStatus(model.ContactStatusNormal), nil},
+		{"muted contact", contactWithStatus(model.ContactStatusMuted), contactWithStatus(model.ContactStatusNormal), nil},
+		{"stranger", nil, nil, ErrNotFriends},
+		{"unfriended", contactWithStatus(model.ContactStatusDeleted), contactWithStatus(model.ContactStatusDeletedBy), ErrNotFriends},
+		{"deleted by receiver", contactWithStatus(model.ContactStatusDeletedBy), contactWithStatus(model.ContactStatusDeleted), ErrNotFriends},
+		{"blocked by receiver", contactWithStatus(model.ContactStatusNormal), contactWithStatus(model.ContactStatusBlacklisted), ErrBlocked},
+		{"sender blocked receiver", contactWithStatus(model.ContactStatusBlacklisted), contactWithStatus(model.ContactStatusNormal), ErrYouBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, directError(tt.sender, tt.receiver))
+		})
+	}
+}
+
+func TestGroupError(t *testing.T) {
+	active := &model.Group{Status: model.GroupStatusActive}
+
+	assert.NoError(t, groupError(active, true, nil))
+	assert.Equal(t, ErrNotGroupMember, groupError(active, false, nil))
+	assert.Equal(t, ErrNotGroupMember, groupError(active, false, contactWithStatus(model.ContactStatusLeftGroup)))
+	assert.Equal(t, ErrKickedFromGroup, groupError(active, false, contactWithStatus(model.ContactStatusKicked)))
+	assert.Equal(t, ErrGroupDissolved, groupError(&model.Group{Status: model.GroupStatusDissolved}, true, nil))
+	assert.Equal(t, ErrGroupDisabled, groupError(&model.Group{Status: model.GroupStatusDisabled}, true, nil))
+}
+
+func TestAsError(t *testing.T) {
+	permErr, ok := AsError(fmt.Errorf("send: %w", ErrBlocked))
+	assert.True(t, ok)
+	assert.Equal(t, "blocked", permErr.Code)
+
+	_, ok = AsError(fmt.Errorf("database down"))
+	assert.False(t, ok)
+}
+
+func TestCanView_Direct(t *testing.T) {
+	msg := &model.Message{SendID: "Ualice", ReceiveID: "Ubob"}
+
+	assert.NoError(t, CanView("Ualice", msg))
+	assert.NoError(t, CanView("Ubob", msg))
+	assert.Equal(t, ErrNotParticipant, CanView("Ucarol", msg))
+}
+
+func TestGroupRole_Owner(t *testing.T) {
+	// The owner is known from the group without a membership lookup
+	role, err := GroupRole(&model.Group{UUID: "Ggroup", OwnerID: "Uowner"}, "Uowner")
+	assert.NoError(t, err)
+	assert.Equal(t, int8(model.GroupRoleOwner), role)
+}
+
+func TestIsGroupManager(t *testing.T) {
+	assert.True(t, IsGroupManager(model.GroupRoleOwner))
+	assert.True(t, IsGroupManager(model.GroupRoleAdmin))
+	assert.False(t, IsGroupManager(model.GroupRoleMember))
+}
@@ -0,0 +1,253 @@
+package pin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageRecalled = errors.New("recalled messages cannot be pinned")
+	ErrNotAllowed      = errors.New("only the group owner or admins can pin messages")
+	ErrAlreadyPinned   = errors.New("message is already pinned")
+	ErrPinNotFound     = errors.New("message is not pinned")
+	ErrPinLimitReached = errors.New("conversation has reached the pin limit")
+)
+
+// Most messages one conversation can have pinned at once
+const maxPinsPerConversation = 10
+
+// PinResponse is a pinned message with a short preview of its content
+type PinResponse struct {
+	MessageID string       `json:"messageId"`
+	PinnedBy  string       `json:"pinnedBy"`
+	PinnedAt  string       `json:"pinnedAt"`
+	Message   *reply.Quote `json:"message"`
+}
+
+// ConversationKey identifies the conversation between userID and receiveID:
+// the group UUID, or both user UUIDs in a fixed order for a direct chat
+func ConversationKey(userID, receiveID string) string {
+	if session.IsGroupID(receiveID) {
+		return receiveID
+	}
+	if userID > receiveID {
+		userID, receiveID = receiveID, userID
+	}
+	return userID + ":" + receiveID
+}
+
+// Pin pins a message to its conversation
+func Pin(messageUUID, userID string) (*PinResponse, error) {
+	msg, err := getPinnableMessage(messageUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled {
+		return nil, ErrMessageRecalled
+	}
+
+	key := ConversationKey(msg.SendID, msg.ReceiveID)
+	p := model.Pin{ConversationID: key, MessageID: msg.UUID, PinnedBy: userID}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockConversation(tx, key); err != nil {
+			return err
+		}
+
+		var existing []model.Pin
+		if err := tx.Where("conversation_id = ?", key).Find(&existing).Error; err != nil {
+			return err
+		}
+		for _, e := range existing {
+			if e.MessageID == msg.UUID {
+				return ErrAlreadyPinned
+			}
+		}
+		if len(existing) >= maxPinsPerConversation {
+			return ErrPinLimitReached
+		}
+		return tx.Create(&p).Error
+	})
+	if errors.Is(err, ErrAlreadyPinned) || errors.Is(err, ErrPinLimitReached) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	resp := toPinResponse(&p, reply.NewQuote(msg))
+	notifyPin("message_pinned", msg, map[string]interface{}{
+		"pinnedBy": userID,
+		"pin":      resp,
+	})
+	return resp, nil
+}
+
+// lockConversation locks a conversation's pin lock row, creating it first if
+// needed, until the transaction ends
+func lockConversation(tx *gorm.DB, key string) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.PinLock{ConversationID: key}).Error; err != nil {
+		return err
+	}
+	var lock model.PinLock
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("conversation_id = ?", key).First(&lock).Error
+}
+
+// Unpin removes a message from its conversation's pins
+func Unpin(messageUUID, userID string) error {
+	msg, err := getPinnableMessage(messageUUID, userID)
+	if err != nil {
+		return err
+	}
+
+	result := database.DB.Where("conversation_id = ? AND message_id = ?", ConversationKey(msg.SendID, msg.ReceiveID), msg.UUID).
+		Delete(&model.Pin{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unpin message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPinNotFound
+	}
+
+	notifyPin("message_unpinned", msg, map[string]interface{}{"unpinnedBy": userID})
+	return nil
+}
+
+// RemoveForMessage drops a message's pin, if any, when it stops being pinnable
+// (for example after a recall) and tells the conversation
+func RemoveForMessage(msg *model.Message) {
+	result := database.DB.Where("message_id = ?", msg.UUID).Delete(&model.Pin{})
+	if result.Error != nil {
+		log.Printf("Failed to remove pins for %s: %v", msg.UUID, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		notifyPin("message_unpinned", msg, map[string]interface{}{"unpinnedBy": msg.SendID})
+	}
+}
+
+// List returns the pins of the conversation between userID and receiveID, newest first
+func List(userID, receiveID string) ([]PinResponse, error) {
+	if err := permission.CanViewConversation(userID, receiveID); err != nil {
+		return nil, err
+	}
+
+	key := ConversationKey(userID, receiveID)
+	pins, err := load([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	if pins[key] == nil {
+		return []PinResponse{}, nil
+	}
+	return pins[key], nil
+}
+
+// LoadForGroups returns the pins of several groups, keyed by group UUID
+func LoadForGroups(groupUUIDs []string) (map[string][]PinResponse, error) {
+	return load(groupUUIDs)
+}
+
+// load returns the pins of the given conversations, newest first, keyed by conversation
+func load(keys []string) (map[string][]PinResponse, error) {
+	result := make(map[string][]PinResponse, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	var pins []model.Pin
+	if err := database.DB.Where("conversation_id IN ?", keys).
+		Order("created_at DESC, id DESC").
+		Find(&pins).Error; err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, len(pins))
+	for i, p := range pins {
+		uuids[i] = p.MessageID
+	}
+	quotes, err := reply.LoadQuotes(uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pins {
+		// Expired messages have no quote and drop out of the list
+		quote := quotes[pins[i].MessageID]
+		if quote == nil {
+			continue
+		}
+		result[pins[i].ConversationID] = append(result[pins[i].ConversationID], *toPinResponse(&pins[i], quote))
+	}
+	return result, nil
+}
+
+// getPinnableMessage loads an unexpired message and checks userID may change
+// its conversation's pins
+func getPinnableMessage(messageUUID, userID string) (*model.Message, error) {
+	var msg model.Message
+	if err := database.DB.Scopes(conversation.Unexpired(time.Now())).
+		Where("uuid = ?", messageUUID).First(&msg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if err := permission.CanView(userID, &msg); err != nil {
+		return nil, err
+	}
+
+	if session.IsGroupID(msg.ReceiveID) {
+		var group model.Group
+		if err := database.DB.Where("uuid = ?", msg.ReceiveID).Select("uuid", "owner_id").
+			First(&group).Error; err != nil {
+			return nil, fmt.Errorf("failed to get group: %w", err)
+		}
+		role, err := permission.GroupRole(&group, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !permission.IsGroupManager(role) {
+			return nil, ErrNotAllowed
+		}
+	}
+	return &msg, nil
+}
+
+// notifyPin tells everyone in the message's conversation about a pin change
+func notifyPin(eventType string, msg *model.Message, extra map[string]interface{}) {
+	data := map[string]interface{}{
+		"messageId": msg.UUID,
+		"sendId":    msg.SendID,
+		"receiveId": msg.ReceiveID,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	chat.GetHub().SendToConversation(msg.SendID, msg.ReceiveID, chat.WSResponse{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+func toPinResponse(p *model.Pin, quote *reply.Quote) *PinResponse {
+	return &PinResponse{
+		MessageID: p.MessageID,
+		PinnedBy:  p.PinnedBy,
+		PinnedAt:  p.CreatedAt.Format("2006-01-02 15:04:05"),
+		Message:   quote,
+	}
+}
@@ -0,0 +1,46 @@
+package pin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/reply"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestConversationKey(t *testing.T) {
+	assert.Equal(t, "Ggroup", ConversationKey("Ualice", "Ggroup"))
+
+	// Both sides of a direct chat share one key
+	assert.Equal(t, "Ualice:Ubob", ConversationKey("Ualice", "Ubob"))
+	assert.Equal(t, "Ualice:Ubob", ConversationKey("Ubob", "Ualice"))
+}
+
+func TestToPinResponse(t *testing.T) {
+	p := &model.Pin{MessageID: "M1", PinnedBy: "Ualice", CreatedAt: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}
+	quote := &reply.Quote{UUID: "M1", Content: "hello"}
+
+	resp := toPinResponse(p, quote)
+
+	assert.Equal(t, "M1", resp.MessageID)
+	assert.Equal(t, "Ualice", resp.PinnedBy)
+	assert.Equal(t, "2024-05-01 09:30:00", resp.PinnedAt)
+	assert.Equal(t, quote, resp.Message)
+}
+
+func TestLockConversation(t *testing.T) {
+	// Pin runs it inside its own transaction
+	db := testutil.DryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var statements []string
+	record := func(tx *gorm.DB) { statements = append(statements, tx.Statement.SQL.String()) }
+	assert.NoError(t, db.Callback().Create().After("gorm:create").Register("test:record", record))
+	assert.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record", record))
+
+	assert.NoError(t, lockConversation(db, "Ualice:Ubob"))
+	assert.Len(t, statements, 2)
+	assert.Contains(t, statements[0], "ON CONFLICT DO NOTHING")
+	assert.Contains(t, statements[1], "FOR UPDATE")
+}
@@ -77,6 +77,19 @@ func Get(key string) (string, error) {
 	return val, nil
 }
 
+// SetNX stores a key-value pair with expiration only if the key does not exist,
+// and reports whether it was stored
+func SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	return client.SetNX(ctx, key, value, expiration).Result()
+}
+
+// DeleteIfValue removes a key only while it still holds value, so a lock is
+// released only by the holder that set it
+func DeleteIfValue(key string, value string) error {
+	return client.Eval(ctx, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`,
+		[]string{key}, value).Err()
+}
+
 // GetOrError retrieves a value by key, returns error if key doesn't exist
 func GetOrError(key string) (string, error) {
 	return client.Get(ctx, key).Result()
@@ -161,3 +174,61 @@ func Publish(channel string, message interface{}) error {
 func Subscribe(channel string) *redis.PubSub {
 	return client.Subscribe(ctx, channel)
 }
+
+// GetAllHashes retrieves all fields from several hashes in a single round trip
+func GetAllHashes(keys []string) ([]map[string]string, error) {
+	pipe := client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	result := make([]map[string]string, len(keys))
+	for i, cmd := range cmds {
+		result[i] = cmd.Val()
+	}
+	return result, nil
+}
+
+// HashLen returns the number of fields in a hash
+func HashLen(key string) (int64, error) {
+	return client.HLen(ctx, key).Result()
+}
+
+// AddSorted adds a member to a sorted set with the given score
+func AddSorted(key, member string, score float64) error {
+	return client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// RemoveSorted removes a member from a sorted set
+func RemoveSorted(key, member string) error {
+	return client.ZRem(ctx, key, member).Err()
+}
+
+// GetSortedScore returns the score of a sorted set member, and false if it is absent
+func GetSortedScore(key, member string) (float64, bool, error) {
+	score, err := client.ZScore(ctx, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return score, true, nil
+}
+
+// GetSortedByMinScore returns all sorted set members with a score of at least min
+func GetSortedByMinScore(key string, min float64) ([]string, error) {
+	return client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%f", min),
+		Max: "+inf",
+	}).Result()
+}
+
+// RemoveSortedBelowScore removes all sorted set members with a score below max
+func RemoveSortedBelowScore(key string, max float64) error {
+	return client.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%f", max)).Err()
+}
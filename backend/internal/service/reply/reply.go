@@ -0,0 +1,100 @@
+package reply
+
+import (
+	"errors"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/conversation"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/session"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReplyNotFound  = errors.New("replied-to message not found")
+	ErrReplyOtherChat = errors.New("replied-to message belongs to another conversation")
+)
+
+// Longest quoted content, in characters, embedded in a reply
+const maxQuoteLen = 100
+
+// Quote is a short preview of the message a reply refers to
+type Quote struct {
+	UUID     string `json:"uuid"`
+	SendID   string `json:"sendId"`
+	SendName string `json:"sendName"`
+	Type     int8   `json:"type"`
+	Content  string `json:"content"`
+	Recalled bool   `json:"recalled,omitempty"`
+}
+
+// Validate loads the message being replied to and checks that it belongs to the
+// conversation between senderID and receiveID and hasn't expired
+func Validate(senderID, receiveID, replyToID string) (*model.Message, error) {
+	var target model.Message
+	if err := database.DB.Scopes(conversation.Unexpired(time.Now())).
+		Where("uuid = ?", replyToID).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReplyNotFound
+		}
+		return nil, err
+	}
+
+	if !InConversation(&target, senderID, receiveID) {
+		return nil, ErrReplyOtherChat
+	}
+	return &target, nil
+}
+
+// InConversation reports whether m was sent in the conversation between userID and receiveID
+func InConversation(m *model.Message, userID, receiveID string) bool {
+	if session.IsGroupID(receiveID) {
+		return m.ReceiveID == receiveID
+	}
+	return (m.SendID == userID && m.ReceiveID == receiveID) ||
+		(m.SendID == receiveID && m.ReceiveID == userID)
+}
+
+// NewQuote builds the preview embedded in replies to m
+func NewQuote(m *model.Message) *Quote {
+	quote := &Quote{
+		UUID:     m.UUID,
+		SendID:   m.SendID,
+		SendName: m.SendName,
+		Type:     m.Type,
+		Recalled: m.Recalled,
+	}
+	if !m.Recalled {
+		quote.Content = truncate(session.Preview(m), maxQuoteLen)
+	}
+	return quote
+}
+
+// LoadQuotes returns previews for the given message UUIDs, keyed by UUID.
+// Expired messages have no preview.
+func LoadQuotes(uuids []string) (map[string]*Quote, error) {
+	quotes := make(map[string]*Quote, len(uuids))
+	if len(uuids) == 0 {
+		return quotes, nil
+	}
+
+	var targets []model.Message
+	if err := database.DB.Scopes(conversation.Unexpired(time.Now())).
+		Where("uuid IN ?", uuids).Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		quotes[targets[i].UUID] = NewQuote(&targets[i])
+	}
+	return quotes, nil
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
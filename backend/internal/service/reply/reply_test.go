@@ -0,0 +1,49 @@
+package reply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInConversation_Direct(t *testing.T) {
+	m := &model.Message{SendID: "Ubob", ReceiveID: "Ualice"}
+
+	assert.True(t, InConversation(m, "Ualice", "Ubob"))
+	assert.True(t, InConversation(m, "Ubob", "Ualice"))
+	assert.False(t, InConversation(m, "Ualice", "Ucarol"))
+	assert.False(t, InConversation(m, "Ucarol", "Ubob"))
+}
+
+func TestInConversation_Group(t *testing.T) {
+	m := &model.Message{SendID: "Ubob", ReceiveID: "Ggroup"}
+
+	assert.True(t, InConversation(m, "Ualice", "Ggroup"))
+	assert.False(t, InConversation(m, "Ualice", "Gother"))
+	assert.False(t, InConversation(m, "Ualice", "Ubob"))
+}
+
+func TestNewQuote(t *testing.T) {
+	quote := NewQuote(&model.Message{UUID: "M1", SendID: "Ubob", SendName: "Bob", Content: "hello"})
+	assert.Equal(t, "M1", quote.UUID)
+	assert.Equal(t, "Bob", quote.SendName)
+	assert.Equal(t, "hello", quote.Content)
+
+	// Media messages are quoted by their preview
+	quote = NewQuote(&model.Message{UUID: "M2", Type: model.MessageTypeImage, URL: "https://example.com/a.png"})
+	assert.Equal(t, "[Image]", quote.Content)
+
+	// Recalled messages don't leak their content
+	quote = NewQuote(&model.Message{UUID: "M3", Content: "secret", Recalled: true})
+	assert.True(t, quote.Recalled)
+	assert.Empty(t, quote.Content)
+}
+
+func TestNewQuote_Truncates(t *testing.T) {
+	quote := NewQuote(&model.Message{UUID: "M1", Content: strings.Repeat("字", maxQuoteLen+10)})
+
+	assert.Equal(t, maxQuoteLen+1, len([]rune(quote.Content)))
+	assert.True(t, strings.HasSuffix(quote.Content, "…"))
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/permission"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/upload"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSendTime   = errors.New("send time must be in the future and within a year")
+	ErrEmptyMessage      = errors.New("message content cannot be empty")
+	ErrTooManyScheduled  = errors.New("too many scheduled messages")
+	ErrScheduledNotFound = errors.New("scheduled message not found")
+	ErrNotPending        = errors.New("scheduled message has already been sent or canceled")
+)
+
+const (
+	// Most messages one user may have waiting to be sent
+	maxPendingPerUser = 100
+
+	// Furthest ahead a message may be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+)
+
+// CreateRequest contains a message to send later
+type CreateRequest struct {
+	SessionID string    `json:"sessionId"`
+	ReceiveID string    `json:"receiveId" binding:"required"`
+	Type      int8      `json:"type"` // 0: text, 1: voice, 2: file, 3: image
+	Content   string    `json:"content"`
+	URL       string    `json:"url,omitempty"`
+	ReplyToID string    `json:"replyToId,omitempty"`
+	Mentions  []string  `json:"mentions,omitempty"`
+	SendAt    time.Time `json:"sendAt" binding:"required"` // RFC 3339
+}
+
+// ScheduledResponse contains scheduled message data for API response
+type ScheduledResponse struct {
+	UUID      string   `json:"uuid"`
+	ReceiveID string   `json:"receiveId"`
+	SessionID string   `json:"sessionId,omitempty"`
+	Type      int8     `json:"type"`
+	Content   string   `json:"content"`
+	URL       string   `json:"url,omitempty"`
+	ReplyToID string   `json:"replyToId,omitempty"`
+	Mentions  []string `json:"mentions,omitempty"`
+	SendAt    string   `json:"sendAt"`
+	Status    int8     `json:"status"` // 0: pending, 1: sending, 2: sent, 3: failed, 4: canceled
+	MessageID string   `json:"messageId,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// Create schedules a message. The send is checked now so obvious mistakes
+// fail early, and checked again when it goes out.
+func Create(userID, nickname, avatar string, req CreateRequest) (*ScheduledResponse, error) {
+	if err := validSendTime(req.SendAt, time.Now()); err != nil {
+		return nil, err
+	}
+	if req.Content == "" && req.URL == "" {
+		return nil, ErrEmptyMessage
+	}
+	if err := permission.CanSend(userID, req.ReceiveID, req.SessionID); err != nil {
+		return nil, err
+	}
+
+	// File details come from the stored upload when the message is sent
+	if req.URL != "" {
+		file, err := upload.ResolveAttachment(userID, req.URL, req.Type)
+		if err != nil {
+			return nil, err
+		}
+		req.URL = upload.URL(file.UUID)
+	}
+
+	var pending int64
+	if err := database.DB.Model(&model.ScheduledMessage{}).
+		Where("send_id = ? AND status IN ?", userID, []int8{model.ScheduledStatusPending, model.ScheduledStatusSending}).
+		Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending >= maxPendingPerUser {
+		return nil, ErrTooManyScheduled
+	}
+
+	scheduled := model.ScheduledMessage{
+		UUID:       "Q" + uuid.New().String()[:11],
+		SendID:     userID,
+		SendName:   nickname,
+		SendAvatar: avatar,
+		ReceiveID:  req.ReceiveID,
+		SessionID:  req.SessionID,
+		Type:       req.Type,
+		Content:    req.Content,
+		URL:        req.URL,
+		ReplyToID:  req.ReplyToID,
+		Mentions:   mention.Encode(req.Mentions),
+		SendAt:     req.SendAt,
+		Status:     model.ScheduledStatusPending,
+	}
+	if err := database.DB.Create(&scheduled).Error; err != nil {
+		return nil, fmt.Errorf("failed to schedule message: %w", err)
+	}
+
+	return toScheduledResponse(&scheduled), nil
+}
+
+// List returns a user's scheduled messages that have not been sent or canceled, soonest first
+func List(userID string) ([]ScheduledResponse, error) {
+	var scheduled []model.ScheduledMessage
+	if err := database.DB.Where("send_id = ? AND status IN ?", userID,
+		[]int8{model.ScheduledStatusPending, model.ScheduledStatusSending, model.ScheduledStatusFailed}).
+		Order("send_at ASC, id ASC").
+		Find(&scheduled).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]ScheduledResponse, 0, len(scheduled))
+	for i := range scheduled {
+		result = append(result, *toScheduledResponse(&scheduled[i]))
+	}
+	return result, nil
+}
+
+// Cancel stops a pending scheduled message from being sent
+func Cancel(scheduledUUID, userID string) error {
+	result := database.DB.Model(&model.ScheduledMessage{}).
+		Where("uuid = ? AND send_id = ? AND status = ?", scheduledUUID, userID, model.ScheduledStatusPending).
+		Update("status", model.ScheduledStatusCanceled)
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var existing model.ScheduledMessage
+	if err := database.DB.Where("uuid = ? AND send_id = ?", scheduledUUID, userID).
+		First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrScheduledNotFound
+		}
+		return err
+	}
+	return ErrNotPending
+}
+
+// validSendTime accepts times after now and no further ahead than maxScheduleAhead
+func validSendTime(sendAt, now time.Time) error {
+	if !sendAt.After(now) || sendAt.Sub(now) > maxScheduleAhead {
+		return ErrInvalidSendTime
+	}
+	return nil
+}
+
+func toScheduledResponse(s *model.ScheduledMessage) *ScheduledResponse {
+	return &ScheduledResponse{
+		UUID:      s.UUID,
+		ReceiveID: s.ReceiveID,
+		SessionID: s.SessionID,
+		Type:      s.Type,
+		Content:   s.Content,
+		URL:       s.URL,
+		ReplyToID: s.ReplyToID,
+		Mentions:  mention.Decode(s.Mentions),
+		SendAt:    s.SendAt.Format("2006-01-02 15:04:05"),
+		Status:    s.Status,
+		MessageID: s.MessageID,
+		Error:     s.Error,
+		CreatedAt: s.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidSendTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, validSendTime(now.Add(time.Minute), now))
+	assert.ErrorIs(t, validSendTime(now, now), ErrInvalidSendTime)
+	assert.ErrorIs(t, validSendTime(now.Add(-time.Hour), now), ErrInvalidSendTime)
+	assert.ErrorIs(t, validSendTime(now.Add(maxScheduleAhead+time.Second), now), ErrInvalidSendTime)
+}
+
+func TestToWSMessage(t *testing.T) {
+	s := &model.ScheduledMessage{
+		UUID:      "Q1",
+		SendID:    "Ualice",
+		ReceiveID: "Ggroup",
+		SessionID: "S1",
+		Content:   "hello",
+		Mentions:  `["Ubob"]`,
+	}
+
+	msg := toWSMessage(s)
+
+	// The scheduled UUID makes retried sends idempotent
+	assert.Equal(t, "scheduled:Q1", msg.ClientMsgID)
+	assert.Equal(t, []string{"Ubob"}, msg.Mentions)
+	assert.Equal(t, "Ggroup", msg.ReceiveID)
+	assert.Equal(t, "S1", msg.SessionID)
+}
+
+func TestToWSMessage_GroupWithoutSession(t *testing.T) {
+	// Group sessions are resolved when the message is routed
+	msg := toWSMessage(&model.ScheduledMessage{UUID: "Q1", SendID: "Ualice", ReceiveID: "Ggroup"})
+	assert.Empty(t, msg.SessionID)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, pollInterval, retryDelay(1))
+	assert.Equal(t, 4*pollInterval, retryDelay(3))
+	assert.Equal(t, maxRetryDelay, retryDelay(20))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abcdef", 2))
+	// Never splits a multi-byte character
+	assert.Equal(t, "a", truncate("aé", 2))
+}
@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/chat"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/mention"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	// How often due messages are looked for
+	pollInterval = 5 * time.Second
+
+	// Most messages sent in one pass
+	batchSize = 100
+
+	// Only one node runs a pass at a time
+	lockKey = "chat:scheduler:lock"
+	lockTTL = time.Minute
+
+	// Messages a crashed node left half-sent are retried after this long
+	staleSendingAfter = 2 * time.Minute
+
+	// Longest stored failure reason
+	maxErrorLen = 255
+
+	// A send that keeps failing is retried with growing delays, then given up
+	maxAttempts   = 8
+	maxRetryDelay = 10 * time.Minute
+)
+
+// Start runs the scheduler until the process exits. Every node may run it;
+// a Redis lock makes sure only one of them sends in each pass.
+func Start() {
+	token := uuid.New().String()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		runOnce(token)
+	}
+}
+
+// runOnce sends due messages if this node holds the scheduler lock
+func runOnce(token string) {
+	locked, err := redis.SetNX(lockKey, token, lockTTL)
+	if err != nil {
+		log.Printf("Failed to acquire scheduler lock: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer func() {
+		if err := redis.DeleteIfValue(lockKey, token); err != nil {
+			log.Printf("Failed to release scheduler lock: %v", err)
+		}
+	}()
+
+	dispatchDue(time.Now())
+}
+
+// dispatchDue sends every pending message whose time has come
+func dispatchDue(now time.Time) {
+	// A node that stopped mid-send leaves rows marked sending; retrying them is
+	// safe because the stored message is deduplicated by its clientMsgId
+	if err := database.DB.Model(&model.ScheduledMessage{}).
+		Where("status = ? AND updated_at < ?", model.ScheduledStatusSending, now.Add(-staleSendingAfter)).
+		Update("status", model.ScheduledStatusPending).Error; err != nil {
+		log.Printf("Failed to requeue stale scheduled messages: %v", err)
+	}
+
+	var due []model.ScheduledMessage
+	if err := database.DB.Where("status = ? AND send_at <= ?", model.ScheduledStatusPending, now).
+		Where("retry_at IS NULL OR retry_at <= ?", now).
+		Order("send_at ASC, id ASC").
+		Limit(batchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("Failed to load due scheduled messages: %v", err)
+		return
+	}
+
+	for i := range due {
+		dispatch(&due[i])
+	}
+}
+
+// dispatch sends one scheduled message through the hub and records the outcome
+func dispatch(s *model.ScheduledMessage) {
+	// Claim the row so it is sent once even if the lock expired mid-pass
+	claim := database.DB.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND status = ?", s.ID, model.ScheduledStatusPending).
+		Update("status", model.ScheduledStatusSending)
+	if claim.Error != nil {
+		log.Printf("Failed to claim scheduled message %s: %v", s.UUID, claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+
+	dbMsg, err := chat.GetHub().Deliver(toWSMessage(s))
+	if err != nil {
+		var sendErr *chat.SendError
+		if !errors.As(err, &sendErr) || sendErr.Code == "internal_error" {
+			log.Printf("Failed to send scheduled message %s: %v", s.UUID, err)
+			if s.Attempts+1 < maxAttempts {
+				// Transient failures are retried on a later pass, backing off
+				setStatus(s, model.ScheduledStatusPending, map[string]interface{}{
+					"attempts": s.Attempts + 1,
+					"retry_at": time.Now().Add(retryDelay(s.Attempts + 1)),
+				})
+				return
+			}
+			sendErr = &chat.SendError{Code: "internal_error", Reason: "failed to send message"}
+		}
+
+		reason := truncate(sendErr.Reason, maxErrorLen)
+		setStatus(s, model.ScheduledStatusFailed, map[string]interface{}{"error": reason})
+		notifySender(s, "scheduled_message_failed", map[string]interface{}{
+			"code":  sendErr.Code,
+			"error": reason,
+		})
+		return
+	}
+
+	setStatus(s, model.ScheduledStatusSent, map[string]interface{}{"message_id": dbMsg.UUID})
+	notifySender(s, "scheduled_message_sent", map[string]interface{}{"messageId": dbMsg.UUID})
+}
+
+// retryDelay is how long to wait before the given attempt at a failed send
+func retryDelay(attempts int) time.Duration {
+	delay := pollInterval
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// toWSMessage builds the message a scheduled send delivers. Its UUID doubles
+// as the clientMsgId, so a retried send never creates a second message. A
+// direct message scheduled without a session goes through the sender's own
+// session, as a message sent now would.
+func toWSMessage(s *model.ScheduledMessage) *chat.WSMessage {
+	sessionID := s.SessionID
+	if sessionID == "" {
+		sessionID = chat.SenderSessionID(s.SendID, s.ReceiveID)
+	}
+
+	return &chat.WSMessage{
+		Type:        int(s.Type),
+		Content:     s.Content,
+		URL:         s.URL,
+		SendID:      s.SendID,
+		SendName:    s.SendName,
+		SendAvatar:  s.SendAvatar,
+		ReceiveID:   s.ReceiveID,
+		SessionID:   sessionID,
+		ReplyToID:   s.ReplyToID,
+		Mentions:    mention.Decode(s.Mentions),
+		ClientMsgID: "scheduled:" + s.UUID,
+	}
+}
+
+// setStatus records a scheduled message's new status with any extra columns
+func setStatus(s *model.ScheduledMessage, status int8, updates map[string]interface{}) {
+	updates["status"] = status
+	if err := database.DB.Model(&model.ScheduledMessage{}).Where("id = ?", s.ID).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to update scheduled message %s: %v", s.UUID, err)
+	}
+}
+
+// notifySender tells the sender's devices what happened to a scheduled message
+func notifySender(s *model.ScheduledMessage, eventType string, extra map[string]interface{}) {
+	data := map[string]interface{}{
+		"uuid":      s.UUID,
+		"receiveId": s.ReceiveID,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	chat.GetHub().SendToUser(s.SendID, chat.WSResponse{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
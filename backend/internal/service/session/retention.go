@@ -0,0 +1,96 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+)
+
+var (
+	ErrInvalidMessageTTL = errors.New("message retention must be 0 or between one minute and one year")
+	ErrGroupSession      = errors.New("group retention is set on the group")
+)
+
+// Bounds on a conversation's retention period, in seconds
+const (
+	MinMessageTTL = 60
+	MaxMessageTTL = 365 * 24 * 60 * 60
+)
+
+// ValidMessageTTL accepts 0, which turns retention off, or a period within bounds
+func ValidMessageTTL(seconds int) error {
+	if seconds == 0 || (seconds >= MinMessageTTL && seconds <= MaxMessageTTL) {
+		return nil
+	}
+	return ErrInvalidMessageTTL
+}
+
+// MessageTTL returns how long new messages in a conversation are kept, or 0 if
+// they are kept forever. A group's period is set on the group; a direct chat
+// uses the longer of the two users' settings, so a missing or deleted session
+// on either side can't turn retention off.
+func MessageTTL(userID, receiveID string) (time.Duration, error) {
+	var seconds int
+	var err error
+	if IsGroupID(receiveID) {
+		err = database.DB.Model(&model.Group{}).
+			Where("uuid = ?", receiveID).
+			Select("COALESCE(MAX(message_ttl), 0)").
+			Scan(&seconds).Error
+	} else {
+		err = database.DB.Unscoped().Model(&model.Session{}).
+			Scopes(conversationSessionsScope(userID, receiveID)).
+			Select("COALESCE(MAX(message_ttl), 0)").
+			Scan(&seconds).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// ExpiresAt returns when a message sent now in a conversation expires. Lookup
+// failures are logged and leave the message without an expiry.
+func ExpiresAt(userID, receiveID string, sentAt time.Time) sql.NullTime {
+	ttl, err := MessageTTL(userID, receiveID)
+	if err != nil {
+		log.Printf("Failed to get message retention: %v", err)
+		return sql.NullTime{}
+	}
+	if ttl <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: sentAt.Add(ttl), Valid: true}
+}
+
+// SetMessageTTL sets the retention period of the direct chat behind one of
+// userID's sessions. Both users' sessions are updated so the chat has a single
+// setting; it applies to messages sent from now on.
+func SetMessageTTL(sessionUUID, userID string, seconds int) (*model.Session, error) {
+	if err := ValidMessageTTL(seconds); err != nil {
+		return nil, err
+	}
+
+	sess, err := GetByUUID(sessionUUID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.SendID != userID {
+		return nil, ErrSessionNotFound
+	}
+	if IsGroupID(sess.ReceiveID) {
+		return nil, ErrGroupSession
+	}
+
+	if err := database.DB.Unscoped().Model(&model.Session{}).
+		Scopes(conversationSessionsScope(userID, sess.ReceiveID)).
+		Update("message_ttl", seconds).Error; err != nil {
+		return nil, err
+	}
+	sess.MessageTTL = seconds
+	return sess, nil
+}
@@ -4,12 +4,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/PlonGuo/GoChatroom/backend/internal/database"
 	"github.com/PlonGuo/GoChatroom/backend/internal/model"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -25,15 +27,21 @@ type SessionResponse struct {
 	LastMessage   string `json:"lastMessage"`
 	LastMessageAt string `json:"lastMessageAt,omitempty"`
 	UnreadCount   int    `json:"unreadCount"`
+	Mentioned     bool   `json:"mentioned"`
+	MessageTTL    int    `json:"messageTtl"` // Seconds new direct messages are kept; 0 keeps them forever
 	UpdatedAt     string `json:"updatedAt"`
 }
 
-// GetOrCreate gets an existing session or creates a new one
+// GetOrCreate gets an existing session or creates a new one. A session the
+// user deleted is restored instead, so the conversation reappears in their list.
 func GetOrCreate(userID, receiveID, receiveName, avatar string) (*model.Session, error) {
 	var session model.Session
+	owned := func(db *gorm.DB) *gorm.DB {
+		return db.Where("send_id = ? AND receive_id = ?", userID, receiveID)
+	}
 
 	// Try to find existing session
-	err := database.DB.Where("send_id = ? AND receive_id = ?", userID, receiveID).First(&session).Error
+	err := database.DB.Scopes(owned).First(&session).Error
 	if err == nil {
 		return &session, nil
 	}
@@ -43,21 +51,200 @@ func GetOrCreate(userID, receiveID, receiveName, avatar string) (*model.Session,
 	}
 
 	// Create new session
-	session = model.Session{
+	missing := []model.Session{{
 		UUID:        "S" + uuid.New().String()[:11],
 		SendID:      userID,
 		ReceiveID:   receiveID,
 		ReceiveName: receiveName,
 		Avatar:      avatar,
+	}}
+	if err := insertSessions(database.DB, missing, owned); err != nil {
+		return nil, err
 	}
 
-	if err := database.DB.Create(&session).Error; err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+	// A concurrent request may have created it first
+	if err := database.DB.Scopes(owned).First(&session).Error; err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
-
 	return &session, nil
 }
 
+// IsGroupID reports whether a receive ID refers to a group rather than a user
+func IsGroupID(receiveID string) bool {
+	return strings.HasPrefix(receiveID, "G")
+}
+
+// RecalledPreview is shown in place of a recalled message
+const RecalledPreview = "[Message recalled]"
+
+// Preview returns the session-list text for a message
+func Preview(m *model.Message) string {
+	if m.Recalled {
+		return RecalledPreview
+	}
+	switch m.Type {
+	case model.MessageTypeVoice:
+		if m.DurationMs > 0 {
+			return "[Voice message " + formatDuration(m.DurationMs) + "]"
+		}
+		return "[Voice message]"
+	case model.MessageTypeFile:
+		return "[File: " + m.FileName + "]"
+	case model.MessageTypeImage:
+		return "[Image]"
+	case model.MessageTypeVideoCall:
+		return "[Video call]"
+	}
+	return m.Content
+}
+
+// formatDuration renders milliseconds as m:ss, rounded to the nearest second
+func formatDuration(ms int64) string {
+	seconds := (ms + 500) / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// GroupPreview formats a group's last-message preview with the sender's name
+func GroupPreview(senderName, content string) string {
+	if senderName == "" {
+		return content
+	}
+	return senderName + ": " + content
+}
+
+// UpdateGroupSessions records a new group message for every member: it creates
+// missing member sessions, sets the last message on all of them and increments
+// the unread count for everyone except the sender. It returns each member's
+// session UUID keyed by member ID.
+func UpdateGroupSessions(groupUUID, senderID, preview string) (map[string]string, error) {
+	var group model.Group
+	if err := database.DB.Where("uuid = ?", groupUUID).First(&group).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	var members []string
+	if err := database.DB.Model(&model.GroupMember{}).Where("group_id = ?", groupUUID).
+		Pluck("user_id", &members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group members: %w", err)
+	}
+	if len(members) == 0 {
+		return map[string]string{}, nil
+	}
+
+	sessionIDs, err := ensureGroupSessions(&group, members)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.Model(&model.Session{}).
+		Scopes(groupSessionsScope(groupUUID, members)).
+		Updates(map[string]interface{}{
+			"last_message":    preview,
+			"last_message_at": sql.NullTime{Time: time.Now(), Valid: true},
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update group sessions: %w", err)
+	}
+
+	if err := database.DB.Model(&model.Session{}).
+		Scopes(groupSessionsScope(groupUUID, members)).
+		Where("send_id <> ?", senderID).
+		Update("unread_count", gorm.Expr("unread_count + 1")).Error; err != nil {
+		return nil, fmt.Errorf("failed to increment group unread counts: %w", err)
+	}
+
+	return sessionIDs, nil
+}
+
+// ensureGroupSessions creates a session for each member that has none yet
+func ensureGroupSessions(group *model.Group, members []string) (map[string]string, error) {
+	var existing []model.Session
+	if err := database.DB.Scopes(groupSessionsScope(group.UUID, members)).
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group sessions: %w", err)
+	}
+
+	sessionIDs := make(map[string]string, len(members))
+	for _, s := range existing {
+		sessionIDs[s.SendID] = s.UUID
+	}
+
+	var missing []model.Session
+	var missingIDs []string
+	for _, memberID := range members {
+		if _, ok := sessionIDs[memberID]; ok {
+			continue
+		}
+		missing = append(missing, model.Session{
+			UUID:        "S" + uuid.New().String()[:11],
+			SendID:      memberID,
+			ReceiveID:   group.UUID,
+			ReceiveName: group.Name,
+			Avatar:      group.Avatar,
+		})
+		missingIDs = append(missingIDs, memberID)
+	}
+	if len(missing) == 0 {
+		return sessionIDs, nil
+	}
+
+	if err := insertSessions(database.DB, missing, groupSessionsScope(group.UUID, missingIDs)); err != nil {
+		return nil, err
+	}
+
+	// Read back the sessions actually stored; a concurrent send to the group
+	// may have created some of them first
+	var created []model.Session
+	if err := database.DB.Scopes(groupSessionsScope(group.UUID, missingIDs)).
+		Find(&created).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group sessions: %w", err)
+	}
+	for _, s := range created {
+		sessionIDs[s.SendID] = s.UUID
+	}
+
+	return sessionIDs, nil
+}
+
+// insertSessions stores new sessions, skipping any that already exist for the
+// same owner and conversation. Deleted sessions selected by scope are restored
+// with nothing unread.
+func insertSessions(db *gorm.DB, sessions []model.Session, scope func(*gorm.DB) *gorm.DB) error {
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sessions).Error; err != nil {
+		return fmt.Errorf("failed to create sessions: %w", err)
+	}
+
+	if err := db.Unscoped().Model(&model.Session{}).
+		Scopes(scope).
+		Where("deleted_at IS NOT NULL").
+		Updates(map[string]interface{}{
+			"deleted_at":   nil,
+			"unread_count": 0,
+			"mentioned":    false,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to restore sessions: %w", err)
+	}
+	return nil
+}
+
+// groupSessionsScope selects the given members' sessions for a group
+func groupSessionsScope(groupUUID string, members []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("receive_id = ? AND send_id IN ?", groupUUID, members)
+	}
+}
+
+// GetTotalUnread returns the sum of unread counts across a user's sessions
+func GetTotalUnread(userID string) (int64, error) {
+	var total int64
+	if err := database.DB.Model(&model.Session{}).
+		Where("send_id = ?", userID).
+		Select("COALESCE(SUM(unread_count), 0)").
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 // GetByUUID retrieves a session by UUID
 func GetByUUID(uuid string) (*model.Session, error) {
 	var session model.Session
@@ -88,6 +275,8 @@ func GetUserSessions(userID string) ([]SessionResponse, error) {
 			Avatar:      s.Avatar,
 			LastMessage: s.LastMessage,
 			UnreadCount: s.UnreadCount,
+			Mentioned:   s.Mentioned,
+			MessageTTL:  s.MessageTTL,
 			UpdatedAt:   s.UpdatedAt.Format("2006-01-02 15:04:05"),
 		}
 		if s.LastMessageAt.Valid {
@@ -109,6 +298,28 @@ func UpdateLastMessage(sessionUUID, content string) error {
 		}).Error
 }
 
+// SetConversationPreview replaces the last-message preview on every session of a
+// conversation without moving it in the session list. For a direct chat both
+// users' sessions are updated; for a group every member's session is.
+func SetConversationPreview(userID, receiveID, preview string) error {
+	return database.DB.Model(&model.Session{}).
+		Scopes(conversationSessionsScope(userID, receiveID)).
+		Update("last_message", preview).Error
+}
+
+// conversationSessionsScope selects all sessions viewing a conversation
+func conversationSessionsScope(userID, receiveID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if IsGroupID(receiveID) {
+			return db.Where("receive_id = ?", receiveID)
+		}
+		return db.Where(
+			"(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)",
+			userID, receiveID, receiveID, userID,
+		)
+	}
+}
+
 // IncrementUnread increments the unread count for a session
 func IncrementUnread(sessionUUID string) error {
 	return database.DB.Model(&model.Session{}).
@@ -116,11 +327,24 @@ func IncrementUnread(sessionUUID string) error {
 		Update("unread_count", gorm.Expr("unread_count + 1")).Error
 }
 
-// ClearUnread clears the unread count for a session
+// MarkMentioned flags the given members' group sessions until they next read them
+func MarkMentioned(groupUUID string, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return database.DB.Model(&model.Session{}).
+		Scopes(groupSessionsScope(groupUUID, userIDs)).
+		Update("mentioned", true).Error
+}
+
+// ClearUnread clears the unread count and mention flag for a session
 func ClearUnread(sessionUUID string) error {
 	return database.DB.Model(&model.Session{}).
 		Where("uuid = ?", sessionUUID).
-		Update("unread_count", 0).Error
+		Updates(map[string]interface{}{
+			"unread_count": 0,
+			"mentioned":    false,
+		}).Error
 }
 
 // Delete soft deletes a session
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestIsGroupID(t *testing.T) {
+	assert.True(t, IsGroupID("G1234567890a"))
+	assert.False(t, IsGroupID("U1234567890a"))
+	assert.False(t, IsGroupID(""))
+}
+
+func TestGroupPreview(t *testing.T) {
+	assert.Equal(t, "Alice: hello", GroupPreview("Alice", "hello"))
+	assert.Equal(t, "Alice: [Image]", GroupPreview("Alice", "[Image]"))
+	assert.Equal(t, "hello", GroupPreview("", "hello"))
+}
+
+func TestGroupSessionsScope(t *testing.T) {
+	db := testutil.DryRunDB(t)
+
+	var sessions []model.Session
+	stmt := db.Scopes(groupSessionsScope("Ggroup", []string{"Ualice", "Ubob"})).
+		Find(&sessions).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "receive_id = $1 AND send_id IN ($2,$3)")
+	assert.Equal(t, []interface{}{"Ggroup", "Ualice", "Ubob"}, stmt.Vars)
+}
+
+func TestPreview(t *testing.T) {
+	assert.Equal(t, "hello", Preview(&model.Message{Type: model.MessageTypeText, Content: "hello"}))
+	assert.Equal(t, "[File: a.pdf]", Preview(&model.Message{Type: model.MessageTypeFile, FileName: "a.pdf"}))
+	assert.Equal(t, "[Voice message]", Preview(&model.Message{Type: model.MessageTypeVoice}))
+	assert.Equal(t, "[Voice message 0:12]", Preview(&model.Message{Type: model.MessageTypeVoice, DurationMs: 11600}))
+	assert.Equal(t, "[Voice message 1:05]", Preview(&model.Message{Type: model.MessageTypeVoice, DurationMs: 65000}))
+	assert.Equal(t, RecalledPreview, Preview(&model.Message{Type: model.MessageTypeText, Recalled: true}))
+}
+
+func TestValidMessageTTL(t *testing.T) {
+	assert.NoError(t, ValidMessageTTL(0))
+	assert.NoError(t, ValidMessageTTL(MinMessageTTL))
+	assert.NoError(t, ValidMessageTTL(MaxMessageTTL))
+	assert.ErrorIs(t, ValidMessageTTL(30), ErrInvalidMessageTTL)
+	assert.ErrorIs(t, ValidMessageTTL(-1), ErrInvalidMessageTTL)
+	assert.ErrorIs(t, ValidMessageTTL(MaxMessageTTL+1), ErrInvalidMessageTTL)
+}
+
+func TestInsertSessions(t *testing.T) {
+	db := testutil.DryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var queries []string
+	record := func(tx *gorm.DB) { queries = append(queries, tx.Statement.SQL.String()) }
+	assert.NoError(t, db.Callback().Create().After("gorm:create").Register("test:record", record))
+	assert.NoError(t, db.Callback().Update().After("gorm:update").Register("test:record", record))
+
+	sessions := []model.Session{{UUID: "Salice", SendID: "Ualice", ReceiveID: "Ggroup"}}
+	assert.NoError(t, insertSessions(db, sessions, groupSessionsScope("Ggroup", []string{"Ualice"})))
+
+	// A session created concurrently is left alone and a deleted one restored
+	assert.Len(t, queries, 2)
+	assert.Contains(t, queries[0], "ON CONFLICT DO NOTHING")
+	assert.Contains(t, queries[1], `UPDATE "sessions" SET "deleted_at"=$1,"mentioned"=$2,"unread_count"=$3`)
+	assert.Contains(t, queries[1], "WHERE deleted_at IS NOT NULL AND (receive_id = $5 AND send_id IN ($6))")
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/config"
+)
+
+var (
+	ErrNotFound = errors.New("object not found")
+)
+
+// Storage stores uploaded file contents by key
+type Storage interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+}
+
+var store Storage
+
+// Init selects the storage backend from configuration
+func Init() error {
+	cfg := config.Get().Storage
+
+	switch cfg.Driver {
+	case "", "local":
+		local, err := NewLocal(cfg.LocalDir)
+		if err != nil {
+			return err
+		}
+		store = local
+		log.Printf("Using local file storage at %s", cfg.LocalDir)
+	case "s3":
+		s3, err := NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle)
+		if err != nil {
+			return err
+		}
+		store = s3
+		log.Printf("Using S3 file storage in bucket %s", cfg.S3Bucket)
+	default:
+		return fmt.Errorf("unknown storage driver: %s", cfg.Driver)
+	}
+	return nil
+}
+
+// Get returns the configured storage backend
+func Get() Storage {
+	return store
+}
@@ -0,0 +1,121 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/media"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/storage"
+)
+
+// MediaInfo is the metadata clients need to lay out an attachment before downloading it
+type MediaInfo struct {
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	BlurHash     string `json:"blurHash,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+}
+
+// ThumbnailURL returns the thumbnail URL of an uploaded file
+func ThumbnailURL(fileUUID string) string {
+	return URL(fileUUID) + "/thumbnail"
+}
+
+// MediaFor returns the metadata of the upload a message URL points at, or
+// nil if it has none yet
+func MediaFor(fileURL string) *MediaInfo {
+	return LoadMedia([]string{fileURL})[fileURL]
+}
+
+// LoadMedia returns metadata for the uploads behind message URLs, keyed by URL
+func LoadMedia(fileURLs []string) map[string]*MediaInfo {
+	result := make(map[string]*MediaInfo)
+
+	byUUID := make(map[string]string)
+	for _, u := range fileURLs {
+		if fileUUID, ok := ParseURL(u); ok {
+			byUUID[fileUUID] = u
+		}
+	}
+	if len(byUUID) == 0 || database.DB == nil {
+		return result
+	}
+
+	uuids := make([]string, 0, len(byUUID))
+	for fileUUID := range byUUID {
+		uuids = append(uuids, fileUUID)
+	}
+
+	var records []model.Upload
+	if err := database.DB.Where("uuid IN ? AND media_status = ?", uuids, model.MediaStatusReady).
+		Find(&records).Error; err != nil {
+		return result
+	}
+	for i := range records {
+		result[byUUID[records[i].UUID]] = toMediaInfo(&records[i])
+	}
+	return result
+}
+
+// OpenThumbnail returns a file's thumbnail if userID may download the file,
+// generating it first if the background worker hasn't
+func OpenThumbnail(fileUUID, userID string) (io.ReadCloser, string, error) {
+	record, err := getByUUID(fileUUID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !canAccess(record, userID) {
+		return nil, "", ErrFileAccessDenied
+	}
+	if !media.Supported(record.MimeType) {
+		return nil, "", ErrFileNotFound
+	}
+
+	if record.ThumbnailKey == "" {
+		if err := media.Process(record.UUID); err != nil {
+			return nil, "", fmt.Errorf("failed to generate thumbnail: %w", err)
+		}
+		if record, err = getByUUID(fileUUID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	content, err := storage.Get().Get(context.Background(), record.ThumbnailKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	return content, media.ThumbnailType(record.MimeType), nil
+}
+
+// RegenerateMedia rebuilds the metadata and thumbnail of a file the user uploaded
+func RegenerateMedia(fileUUID, userID string) (*FileResponse, error) {
+	record, err := getByUUID(fileUUID)
+	if err != nil {
+		return nil, err
+	}
+	if record.OwnerID != userID {
+		return nil, ErrFileAccessDenied
+	}
+	if !media.Supported(record.MimeType) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	if err := media.Process(record.UUID); err != nil {
+		return nil, fmt.Errorf("failed to regenerate media: %w", err)
+	}
+	if record, err = getByUUID(fileUUID); err != nil {
+		return nil, err
+	}
+	return toFileResponse(record), nil
+}
+
+func toMediaInfo(u *model.Upload) *MediaInfo {
+	info := &MediaInfo{Width: u.Width, Height: u.Height, BlurHash: u.BlurHash}
+	if u.ThumbnailKey != "" {
+		info.ThumbnailURL = ThumbnailURL(u.UUID)
+	}
+	return info
+}
@@ -0,0 +1,326 @@
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/config"
+	"github.com/PlonGuo/GoChatroom/backend/internal/database"
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/media"
+	"github.com/PlonGuo/GoChatroom/backend/internal/service/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmptyFile          = errors.New("file is empty")
+	ErrFileTooLarge       = errors.New("file is too large")
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+	ErrFileNotFound       = errors.New("file not found")
+	ErrFileAccessDenied   = errors.New("file access denied")
+	ErrInvalidAttachment  = errors.New("attachment must be a file uploaded to this server")
+)
+
+// URLPrefix is the path uploaded files are served from
+const URLPrefix = "/api/v1/files/"
+
+// Longest stored file name, in runes
+const maxFileNameLen = 100
+
+// allowedTypes are the sniffed MIME types accepted for upload. Types a
+// browser would render as a page, like HTML or SVG, are never accepted.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"audio/aiff":      true,
+	"audio/basic":     true,
+	"audio/midi":      true,
+	"application/ogg": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/avi":       true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+}
+
+// FileResponse describes an uploaded file
+type FileResponse struct {
+	UUID        string `json:"uuid"`
+	URL         string `json:"url"`
+	FileName    string `json:"fileName"`
+	MimeType    string `json:"mimeType"`
+	FileSize    int64  `json:"fileSize"`
+	MessageType int8   `json:"messageType"` // Suggested message type for sending the file
+	CreatedAt   string `json:"createdAt"`
+
+	Media *MediaInfo `json:"media,omitempty"`
+
+	DurationMs int64 `json:"durationMs,omitempty"`
+	Waveform   []int `json:"waveform,omitempty"`
+}
+
+// MaxSize returns the largest accepted upload, in bytes
+func MaxSize() int64 {
+	return int64(config.Get().Storage.MaxUploadMB) << 20
+}
+
+// Save validates and stores a file uploaded by ownerID
+func Save(ownerID, fileName string, size int64, r io.Reader) (*FileResponse, error) {
+	if size <= 0 {
+		return nil, ErrEmptyFile
+	}
+	if size > MaxSize() {
+		return nil, ErrFileTooLarge
+	}
+
+	// Sniff the type from the content rather than trusting the client
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	mimeType := detectType(head)
+	if !allowedTypes[mimeType] {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	fileName = cleanFileName(fileName)
+	record := model.Upload{
+		UUID:     "F" + uuid.New().String()[:11],
+		OwnerID:  ownerID,
+		FileName: fileName,
+		MimeType: mimeType,
+		Size:     size,
+	}
+	record.StorageKey = storageKey(ownerID, record.UUID, fileName, time.Now())
+	if media.Supported(mimeType) {
+		record.MediaStatus = model.MediaStatusPending
+	}
+
+	// Keep a copy of audio while storing it, to measure it afterwards
+	var content io.Reader = io.LimitReader(br, size)
+	var audio *bytes.Buffer
+	if media.AudioSupported(mimeType) {
+		audio = bytes.NewBuffer(make([]byte, 0, size))
+		content = io.TeeReader(content, audio)
+	}
+
+	ctx := context.Background()
+	if err := storage.Get().Put(ctx, record.StorageKey, content, size, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+	if audio != nil {
+		// Files that can't be measured are still kept, but can't be sent as voice messages
+		if info, err := media.AnalyzeAudio(audio.Bytes(), mimeType); err == nil {
+			record.DurationMs = info.DurationMs
+			record.Waveform = media.EncodeWaveform(info.Waveform)
+		}
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		storage.Get().Delete(ctx, record.StorageKey)
+		return nil, fmt.Errorf("failed to save file record: %w", err)
+	}
+	if record.MediaStatus == model.MediaStatusPending {
+		media.Enqueue(record.UUID)
+	}
+
+	return toFileResponse(&record), nil
+}
+
+// Open returns a file's record and contents if userID may download it
+func Open(fileUUID, userID string) (*model.Upload, io.ReadCloser, error) {
+	record, err := getByUUID(fileUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !canAccess(record, userID) {
+		return nil, nil, ErrFileAccessDenied
+	}
+
+	content, err := storage.Get().Get(context.Background(), record.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrFileNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return record, content, nil
+}
+
+// ResolveAttachment checks that a message URL points at a file userID may
+// attach, one they uploaded or one from a message they can see, and that it
+// suits the message type
+func ResolveAttachment(userID, fileURL string, msgType int8) (*model.Upload, error) {
+	fileUUID, ok := ParseURL(fileURL)
+	if !ok {
+		return nil, ErrInvalidAttachment
+	}
+	record, err := getByUUID(fileUUID)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, ErrInvalidAttachment
+		}
+		return nil, err
+	}
+	if !canAccess(record, userID) {
+		return nil, ErrInvalidAttachment
+	}
+
+	switch msgType {
+	case model.MessageTypeVoice:
+		if record.DurationMs <= 0 {
+			return nil, fmt.Errorf("%w: voice messages need a WAV or Ogg audio file", ErrInvalidAttachment)
+		}
+	case model.MessageTypeImage:
+		if !strings.HasPrefix(record.MimeType, "image/") {
+			return nil, fmt.Errorf("%w: image messages need an image file", ErrInvalidAttachment)
+		}
+	}
+	return record, nil
+}
+
+// URL returns the download URL of an uploaded file
+func URL(fileUUID string) string {
+	return URLPrefix + fileUUID
+}
+
+// ParseURL extracts the file UUID from a download URL, which may be absolute
+func ParseURL(fileURL string) (string, bool) {
+	i := strings.Index(fileURL, URLPrefix)
+	if i < 0 {
+		return "", false
+	}
+	fileUUID := fileURL[i+len(URLPrefix):]
+	if fileUUID == "" || strings.ContainsAny(fileUUID, "/?#") {
+		return "", false
+	}
+	return fileUUID, true
+}
+
+// MessageType suggests the message type for a file of the given MIME type
+func MessageType(mimeType string) int8 {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return model.MessageTypeImage
+	case strings.HasPrefix(mimeType, "audio/"), mimeType == "application/ogg":
+		return model.MessageTypeVoice
+	default:
+		return model.MessageTypeFile
+	}
+}
+
+func getByUUID(fileUUID string) (*model.Upload, error) {
+	var record model.Upload
+	if err := database.DB.Where("uuid = ?", fileUUID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// canAccess reports whether userID uploaded the file or can see a message that links it
+func canAccess(record *model.Upload, userID string) bool {
+	if record.OwnerID == userID {
+		return true
+	}
+
+	var visible bool
+	if err := database.DB.Raw("SELECT EXISTS (?)", visibleReferences(database.DB, record, userID)).
+		Scan(&visible).Error; err != nil {
+		return false
+	}
+	return visible
+}
+
+// visibleReferences selects the live messages linking a file that userID can
+// see, the same ones permission.CanView allows: their direct chats, and groups
+// they belong to that are still active
+func visibleReferences(db *gorm.DB, record *model.Upload, userID string) *gorm.DB {
+	groups := db.Unscoped().Model(&model.Group{}).Select("uuid")
+	activeGroups := db.Model(&model.Group{}).Select("uuid").Where("status = ?", model.GroupStatusActive)
+	memberships := db.Model(&model.GroupMember{}).Select("group_id").
+		Where("user_id = ? AND group_id IN (?)", userID, activeGroups)
+
+	return db.Model(&model.Message{}).Select("1").
+		Where("url = ? AND recalled = ?", URL(record.UUID), false).
+		Where("receive_id = ? OR (send_id = ? AND receive_id NOT IN (?)) OR receive_id IN (?)",
+			userID, userID, groups, memberships)
+}
+
+// detectType sniffs a file's MIME type, without parameters
+func detectType(head []byte) string {
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
+
+// cleanFileName keeps the base name of a client-supplied file name, bounded in length
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if !utf8.ValidString(name) || name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > maxFileNameLen {
+		name = string(runes[len(runes)-maxFileNameLen:])
+	}
+	return name
+}
+
+// storageKey places a file under its owner and month, keeping the extension
+func storageKey(ownerID, fileUUID, fileName string, now time.Time) string {
+	ext := strings.ToLower(path.Ext(fileName))
+	if len(ext) > 10 || strings.ContainsAny(ext, " %") {
+		ext = ""
+	}
+	return fmt.Sprintf("%s/%s/%s%s", ownerID, now.Format("2006/01"), fileUUID, ext)
+}
+
+func toFileResponse(u *model.Upload) *FileResponse {
+	resp := &FileResponse{
+		UUID:        u.UUID,
+		URL:         URL(u.UUID),
+		FileName:    u.FileName,
+		MimeType:    u.MimeType,
+		FileSize:    u.Size,
+		MessageType: MessageType(u.MimeType),
+		CreatedAt:   u.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if u.MediaStatus == model.MediaStatusReady {
+		resp.Media = toMediaInfo(u)
+	}
+	if u.DurationMs > 0 {
+		resp.DurationMs = u.DurationMs
+		resp.Waveform = media.DecodeWaveform(u.Waveform)
+	} else if resp.MessageType == model.MessageTypeVoice {
+		// Audio that couldn't be measured can only be sent as a file
+		resp.MessageType = model.MessageTypeFile
+	}
+	return resp
+}
@@ -0,0 +1,70 @@
+package upload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlonGuo/GoChatroom/backend/internal/model"
+	"github.com/PlonGuo/GoChatroom/backend/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectType(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")
+	assert.Equal(t, "image/png", detectType(png))
+	assert.Equal(t, "text/plain", detectType([]byte("hello world")))
+
+	// HTML is sniffed as such and must not be accepted
+	html := detectType([]byte("<!DOCTYPE html><html><script>alert(1)</script></html>"))
+	assert.Equal(t, "text/html", html)
+	assert.False(t, allowedTypes[html])
+}
+
+func TestCleanFileName(t *testing.T) {
+	assert.Equal(t, "report.pdf", cleanFileName("../../etc/report.pdf"))
+	assert.Equal(t, "photo.png", cleanFileName(`C:\Users\alice\photo.png`))
+	assert.Equal(t, "file", cleanFileName(""))
+	assert.Equal(t, "ab.txt", cleanFileName("a\x00b.txt"))
+}
+
+func TestStorageKey(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Ualice/2025/03/F1.png", storageKey("Ualice", "F1", "Photo.PNG", now))
+	assert.Equal(t, "Ualice/2025/03/F1", storageKey("Ualice", "F1", "README", now))
+}
+
+func TestParseURL(t *testing.T) {
+	id, ok := ParseURL("/api/v1/files/Fabc")
+	assert.True(t, ok)
+	assert.Equal(t, "Fabc", id)
+
+	id, ok = ParseURL("https://chat.example.com/api/v1/files/Fabc")
+	assert.True(t, ok)
+	assert.Equal(t, "Fabc", id)
+
+	_, ok = ParseURL("https://evil.example.com/cat.png")
+	assert.False(t, ok)
+	_, ok = ParseURL("/api/v1/files/Fabc/../x")
+	assert.False(t, ok)
+}
+
+func TestMessageType(t *testing.T) {
+	assert.Equal(t, int8(model.MessageTypeImage), MessageType("image/png"))
+	assert.Equal(t, int8(model.MessageTypeVoice), MessageType("audio/mpeg"))
+	assert.Equal(t, int8(model.MessageTypeFile), MessageType("application/pdf"))
+}
+
+func TestVisibleReferences(t *testing.T) {
+	db := testutil.DryRunDB(t)
+	var visible bool
+	stmt := db.Raw("SELECT EXISTS (?)", visibleReferences(db, &model.Upload{UUID: "F1"}, "Ualice")).
+		Scan(&visible).Statement
+
+	// One query over every referencing message, however widely it was shared
+	sql := stmt.SQL.String()
+	assert.Contains(t, sql, "SELECT EXISTS (SELECT 1 FROM \"messages\" WHERE (url = $1 AND recalled = $2)")
+	assert.Contains(t, sql, "receive_id = $3 OR (send_id = $4 AND receive_id NOT IN (SELECT \"uuid\" FROM \"groups\"))")
+	assert.Contains(t, sql, "OR receive_id IN (SELECT \"group_id\" FROM \"group_members\" WHERE user_id = $5 AND group_id IN (SELECT \"uuid\" FROM \"groups\" WHERE status = $6")
+	assert.NotContains(t, sql, "LIMIT")
+	assert.Equal(t, "/api/v1/files/F1", stmt.Vars[0])
+}
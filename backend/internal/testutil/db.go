@@ -0,0 +1,23 @@
+// Package testutil holds helpers shared by the service tests
+package testutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// DryRunDB returns a database handle that builds PostgreSQL statements
+// without connecting. Statements that write need
+// Session(&gorm.Session{SkipDefaultTransaction: true}), since opening a
+// transaction would connect.
+func DryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost sslmode=disable"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.NoError(t, err)
+	return db
+}
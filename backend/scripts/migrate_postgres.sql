@@ -1,5 +1,7 @@
 -- PostgreSQL Migration Script
 -- Converts CHAR columns to VARCHAR to prevent space padding issues
+-- Run it before starting the server: on startup the server copies
+-- groups.members into group_members and drops the column
 
 -- Start transaction
 BEGIN;
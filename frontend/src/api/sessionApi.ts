@@ -1,5 +1,5 @@
 import apiClient from './client';
-import type { ApiResponse, Session, CreateSessionRequest, Message, SendMessageRequest } from '../types';
+import type { ApiResponse, Session, CreateSessionRequest, Message, MessagePage, SendMessageRequest } from '../types';
 
 export const getSessions = async (): Promise<Session[]> => {
   const response = await apiClient.get<ApiResponse<Session[]>>('/api/v1/sessions');
@@ -39,14 +39,14 @@ export const clearSessionUnread = async (uuid: string): Promise<void> => {
   }
 };
 
-export const getMessages = async (sessionId: string, limit = 50, offset = 0): Promise<Message[]> => {
-  const response = await apiClient.get<ApiResponse<Message[]>>('/api/v1/messages', {
-    params: { sessionId, limit, offset },
+export const getMessages = async (sessionId: string, limit = 50, before?: string): Promise<Message[]> => {
+  const response = await apiClient.get<ApiResponse<MessagePage>>('/api/v1/messages', {
+    params: { sessionId, limit, before },
   });
   if (response.data.code !== 0) {
     throw new Error(response.data.message);
   }
-  return response.data.data || [];
+  return response.data.data?.messages || [];
 };
 
 export const sendMessage = async (data: SendMessageRequest): Promise<Message> => {
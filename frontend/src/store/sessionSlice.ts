@@ -61,9 +61,9 @@ export const createGroupSession = createAsyncThunk(
 
 export const fetchMessages = createAsyncThunk(
   'session/fetchMessages',
-  async ({ sessionId, limit, offset }: { sessionId: string; limit?: number; offset?: number }, { rejectWithValue }) => {
+  async ({ sessionId, limit, before }: { sessionId: string; limit?: number; before?: string }, { rejectWithValue }) => {
     try {
-      return await sessionApi.getMessages(sessionId, limit, offset);
+      return await sessionApi.getMessages(sessionId, limit, before);
     } catch (error) {
       return rejectWithValue(error instanceof Error ? error.message : 'Failed to fetch messages');
     }
@@ -15,6 +15,12 @@ export interface Message {
   createdAt: string;
 }
 
+export interface MessagePage {
+  messages: Message[];
+  hasBefore: boolean;
+  hasAfter: boolean;
+}
+
 export const MessageType = {
   Text: 0,
   Voice: 1,